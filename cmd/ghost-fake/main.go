@@ -0,0 +1,134 @@
+// Command ghost-fake serves a fake Ghost API, to try the provider locally
+// without a Ghost instance:
+//
+//	$ ghost-fake -port 5000 -state ghost.json -fixtures fixtures.json
+//	$ GHOST_ENDPOINT=http://localhost:5000 GHOST_USER=ghost GHOST_PASSWORD=ghost terraform apply
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+
+	"cloud-deploy.io/terraform-provider-cloud-deploy/ghost/ghosttest"
+)
+
+func main() {
+	host := flag.String("host", "localhost", "Host to listen on")
+	port := flag.Int("port", 5000, "Port to listen on")
+	statePath := flag.String("state", "", "JSON file to persist the items to, kept in memory only if empty")
+	fixturesPath := flag.String("fixtures", "", "JSON file of items to insert at startup, by resource name")
+	options := ghosttest.Options{}
+	flag.DurationVar(&options.JobDuration, "job-duration", 0, "Time taken by jobs to run, e.g. 30s")
+	flag.Float64Var(&options.JobFailureRate, "job-failure-rate", 0, "Probability, between 0 and 1, for a job to fail")
+	flag.Float64Var(&options.ErrorRate, "error-rate", 0, "Probability, between 0 and 1, for a request to fail with a 500 error")
+	flag.StringVar(&options.Version, "version", ghosttest.Version, "Version reported by the version endpoint")
+	flag.Parse()
+
+	var h *ghosttest.Handler
+	if *statePath != "" {
+		var mu sync.Mutex
+		options.OnChange = func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err := saveState(h, *statePath); err != nil {
+				log.Printf("[ERROR] Error saving state to %s: %v", *statePath, err)
+			}
+		}
+	}
+	h = ghosttest.NewHandler(options)
+
+	if *statePath != "" {
+		if err := loadState(h, *statePath); err != nil {
+			log.Fatalf("[ERROR] Error loading state from %s: %v", *statePath, err)
+		}
+	}
+	if *fixturesPath != "" {
+		if err := insertFixtures(h, *fixturesPath); err != nil {
+			log.Fatalf("[ERROR] Error inserting fixtures from %s: %v", *fixturesPath, err)
+		}
+	}
+
+	addr := fmt.Sprintf("%s:%d", *host, *port)
+	log.Printf("[INFO] Serving a fake Ghost API on http://%s, with user %q and password %q, or token %q",
+		addr, ghosttest.Username, ghosttest.Password, ghosttest.Token)
+	log.Fatal(http.ListenAndServe(addr, logRequests(h)))
+}
+
+func loadState(h *ghosttest.Handler, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return h.Load(f)
+}
+
+// Write the state to a temporary file first, so that it's never left half
+// written
+func saveState(h *ghosttest.Handler, path string) error {
+	var buf bytes.Buffer
+	if err := h.Dump(&buf); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Insert the items of a fixtures file, apps first so that jobs can refer to
+// them, skipping the ones whose _id is already stored so that fixtures can be
+// inserted on each startup
+func insertFixtures(h *ghosttest.Handler, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fixtures := map[string][]map[string]interface{}{}
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return err
+	}
+
+	resources := []string{"apps"}
+	for resource := range fixtures {
+		if resource != "apps" {
+			resources = append(resources, resource)
+		}
+	}
+
+	for _, resource := range resources {
+		for i, item := range fixtures[resource] {
+			if id, ok := item["_id"].(string); ok {
+				if _, err := h.Get(resource, id); err == nil {
+					continue
+				}
+			}
+			if _, err := h.Insert(resource, item); err != nil {
+				return fmt.Errorf("%s.%d: %v", resource, i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[DEBUG] %s %s", r.Method, r.URL)
+		h.ServeHTTP(w, r)
+	})
+}
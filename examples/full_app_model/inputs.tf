@@ -1 +1,3 @@
 variable "password" {}
+
+variable "db_password" {}
@@ -65,6 +65,11 @@ resource "ghost_app" "basic" {
     enable_metrics = true
   }
 
+  // Module scripts and lifecycle hooks are rendered with Go templates, using
+  // the app (.App), the module (.Module) and the non sensitive environment
+  // variables (.Vars)
+  render_templates = true
+
   modules = [
     {
       name             = "wordpress"
@@ -75,7 +80,7 @@ resource "ghost_app" "basic" {
       gid              = 0
       build_pack       = ""
       pre_deploy       = ""
-      post_deploy      = ""
+      post_deploy      = "echo \"Deployed {{ .App.Name }} ({{ .App.Env }}) in {{ .Module.Path }}\""
       after_all_deploy = ""
     },
   ]
@@ -101,6 +106,28 @@ resource "ghost_app" "basic" {
                       }
                       JSON
     },
+    {
+      name        = "nginx"
+      provisioner = "ansible"
+
+      // Parameters can also be written as blocks with typed values
+      parameter = [
+        {
+          name  = "worker_processes"
+          value = "4"
+          type  = "number"
+        },
+        {
+          name  = "server_name"
+          value = "wordpress.domain.com"
+        },
+        {
+          name  = "modules"
+          value = "[\"gzip\", \"ssl\"]"
+          type  = "json"
+        },
+      ]
+    },
   ]
 
   lifecycle_hooks = {
@@ -122,6 +149,14 @@ resource "ghost_app" "basic" {
     },
   ]
 
+  // Values are masked in plans and only stored as a hash in state
+  sensitive_environment_variables = [
+    {
+      key   = "db_password"
+      value = "${var.db_password}"
+    },
+  ]
+
   safe_deployment = {
     load_balancer_type = "elb"
     wait_before_deploy = 10
@@ -131,3 +166,11 @@ resource "ghost_app" "basic" {
     ha_backend         = ""
   }
 }
+
+output "app_api_url" {
+  value = "${ghost_app.basic.api_url}"
+}
+
+output "app_last_modified_by" {
+  value = "${ghost_app.basic.last_modified_by}"
+}
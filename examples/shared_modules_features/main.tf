@@ -35,9 +35,17 @@ resource "ghost_app" "shared_modules_features" {
   }
 
   // Several modules and/or lists of modules can be merged together.
+  // Modules can also be declared in keyed_modules instead, where they are
+  // identified by their unique name and their order attribute, giving the
+  // deployment order, so that inserting a module only shows this module in
+  // the plan. An app without modules sets modules = [].
   modules = "${concat(list(local.custom_module_1, local.custom_module_2), local.basic_modules)}"
 
   features = ["${local.custom_feature}"]
+
+  // Environment variables can also be defined as a map, for instance to merge
+  // shared variables with app specific ones. Keys are sent to Ghost sorted.
+  environment_variables_map = "${merge(local.common_environment_variables, map("APP_ROLE", "webfront"))}"
 }
 
 // Defining modules in locals allows to reuse them into different apps without having
@@ -49,8 +57,12 @@ locals {
     scope    = "code"
     git_repo = "https://github.com/KnpLabs/KnpIpsum.git"
 
-    // You can load scripts from files
-    post_deploy = "${file("post_deploy.txt")}"
+    // You can load scripts from files. With the _file variant, only a hash
+    // and a preview of the script are stored in state. The changed lines of
+    // scripts are shown by scripts_diff in plans: those of scripts loaded from
+    // files are compared to the ones read from Ghost, and left out when Ghost
+    // can't be reached.
+    post_deploy_file = "post_deploy.txt"
 
     // You can also use heredocs
     pre_deploy = <<-SCRIPT
@@ -101,3 +113,10 @@ locals {
                     JSON
   }
 }
+
+locals {
+  common_environment_variables = {
+    APP_ENV = "dev"
+    LOG_DIR = "/var/log/app"
+  }
+}
@@ -0,0 +1,120 @@
+package ghost
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Authenticator adds credentials to the requests sent to the Ghost API
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// Refresher is implemented by authenticators whose credentials can be renewed,
+// which is done once when the API rejects them with a 401 response
+type Refresher interface {
+	Refresh() error
+}
+
+// BasicAuth authenticates requests with a username and a password
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authenticate sets the basic auth header of a request
+func (a BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// BearerToken authenticates requests with a static bearer token
+type BearerToken string
+
+// Authenticate sets the bearer token header of a request
+func (t BearerToken) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// TokenSource authenticates requests with a bearer token fetched on first
+// use, and fetched again when the API rejects it
+type TokenSource struct {
+	fetch func() (string, error)
+
+	mu    sync.Mutex
+	token string
+}
+
+// NewTokenSource returns a token source calling fetch to get a token
+func NewTokenSource(fetch func() (string, error)) *TokenSource {
+	return &TokenSource{fetch: fetch}
+}
+
+// NewFileTokenSource returns a token source reading the token from a file,
+// e.g. one kept up to date by an SSO agent
+func NewFileTokenSource(path string) *TokenSource {
+	return NewTokenSource(func() (string, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("Error reading token file: %v", err)
+		}
+		return string(data), nil
+	})
+}
+
+// NewCommandTokenSource returns a token source using the output of a shell
+// command as token
+func NewCommandTokenSource(command string) *TokenSource {
+	return NewTokenSource(func() (string, error) {
+		var stderr bytes.Buffer
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("Error running token command: %v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return string(out), nil
+	})
+}
+
+// Authenticate sets the bearer token header of a request, fetching the token
+// if needed
+func (s *TokenSource) Authenticate(req *http.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == "" {
+		if err := s.refresh(); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	return nil
+}
+
+// Refresh fetches the token again
+func (s *TokenSource) Refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refresh()
+}
+
+func (s *TokenSource) refresh() error {
+	token, err := s.fetch()
+	if err != nil {
+		return err
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return fmt.Errorf("Empty token")
+	}
+	s.token = token
+	return nil
+}
@@ -0,0 +1,121 @@
+package ghost
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"cloud-deploy.io/cloud-deploy-sdk-go"
+)
+
+// Cloud Deploy feature requiring a minimum server version
+type ghostAppCapability struct {
+	// Attribute of the feature, with its value if only some values need the
+	// version
+	Attribute string
+
+	// Minimum Cloud Deploy version
+	Version string
+
+	// Whether an app uses the feature, with the provider defaults
+	used func(d ghostAppResourceConfig, defaults GhostAppDefaults) bool
+
+	// Remove the feature from an app sent to Ghost, nil if it's not sent
+	omit func(app *ghost.App)
+}
+
+// Features of the apps which older Cloud Deploy versions don't have
+var ghostAppCapabilities = []ghostAppCapability{
+	{
+		Attribute: "blue_green",
+		Version:   "17.03",
+		used: func(d ghostAppResourceConfig, defaults GhostAppDefaults) bool {
+			return len(d.Get("blue_green").([]interface{})) > 0
+		},
+	},
+	{
+		Attribute: `safe_deployment.load_balancer_type = "haproxy"`,
+		Version:   "17.03",
+		used: func(d ghostAppResourceConfig, defaults GhostAppDefaults) bool {
+			return ghostAppLoadBalancerType(d, defaults) == "haproxy"
+		},
+	},
+	{
+		Attribute: `safe_deployment.load_balancer_type = "alb"`,
+		Version:   "17.12",
+		used: func(d ghostAppResourceConfig, defaults GhostAppDefaults) bool {
+			return ghostAppLoadBalancerType(d, defaults) == "alb"
+		},
+	},
+	{
+		Attribute: "build_infos.source_container_image",
+		Version:   "17.12",
+		used: func(d ghostAppResourceConfig, defaults GhostAppDefaults) bool {
+			return d.Get("build_infos.0.source_container_image").(string) != ""
+		},
+		omit: func(app *ghost.App) {
+			if app.BuildInfos != nil {
+				app.BuildInfos.SourceContainerImage = ""
+			}
+		},
+	},
+}
+
+// Get the load balancer type of the safe deployment of an app, empty if none
+func ghostAppLoadBalancerType(d ghostAppResourceConfig, defaults GhostAppDefaults) string {
+	safeDeployment := effectiveGhostAppDefaults(d, defaults).SafeDeployment
+	if safeDeployment == nil {
+		return ""
+	}
+	return safeDeployment.LoadBalancerType
+}
+
+// Check that the features used by an app are supported by the Ghost server
+func validateGhostAppCapabilities(d ghostAppResourceConfig, client *GhostClient) []error {
+	var errs []error
+	for _, capability := range ghostAppCapabilities {
+		if !client.supports(capability.Version) && capability.used(d, client.Defaults) {
+			errs = append(errs, fmt.Errorf("attribute %s requires Cloud Deploy >= %s, the server runs %s",
+				capability.Attribute, capability.Version, client.ServerVersion))
+		}
+	}
+	return errs
+}
+
+// Remove the features not supported by the Ghost server from an app, for the
+// values which were not known at plan time
+func omitUnsupportedGhostAppFields(d ghostAppResourceConfig, app *ghost.App, client *GhostClient) {
+	for _, capability := range ghostAppCapabilities {
+		if capability.omit != nil && !client.supports(capability.Version) && capability.used(d, client.Defaults) {
+			log.Printf("[WARN] Omitting %s, which requires Cloud Deploy >= %s, the server runs %s",
+				capability.Attribute, capability.Version, client.ServerVersion)
+			capability.omit(app)
+		}
+	}
+}
+
+// Whether the Ghost server has the given version or a later one, assuming it
+// has when its version is unknown
+func (c *GhostClient) supports(version string) bool {
+	return c.ServerVersion == "" || compareGhostVersions(c.ServerVersion, version) >= 0
+}
+
+// Compare two versions, e.g. 17.12 and 18.05.1, returning a negative number
+// if a is older than b, a positive one if it's newer, and 0 if they're equal
+func compareGhostVersions(a string, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		if i < len(as) {
+			an, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			bn, _ = strconv.Atoi(bs[i])
+		}
+		if an != bn {
+			return an - bn
+		}
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package ghost
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud-deploy.io/cloud-deploy-sdk-go"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestCompareGhostVersions(t *testing.T) {
+	cases := []struct {
+		A        string
+		B        string
+		Expected int
+	}{
+		{"18.05", "18.05", 0},
+		{"18.05", "17.12", 1},
+		{"17.12", "18.05", -1},
+		{"17.12", "17.06", 1},
+		{"18.05.1", "18.05", 1},
+		{"18.05", "18.05.0", 0},
+		{"18.5", "18.05", 0},
+	}
+
+	for _, tc := range cases {
+		output := compareGhostVersions(tc.A, tc.B)
+		if output > 0 {
+			output = 1
+		} else if output < 0 {
+			output = -1
+		}
+		if output != tc.Expected {
+			t.Fatalf("Unexpected output from compareGhostVersions(%s, %s)\nExpected: %#v\nGiven:    %#v",
+				tc.A, tc.B, tc.Expected, output)
+		}
+	}
+}
+
+func TestValidateGhostAppCapabilities(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceGhostApp().Schema, map[string]interface{}{
+		"name": "app_name",
+		"env":  "test",
+		"build_infos": []interface{}{
+			map[string]interface{}{
+				"subnet_id":              "subnet-a7e849fe",
+				"source_container_image": "debian/9",
+			},
+		},
+		"blue_green": []interface{}{
+			map[string]interface{}{"enable_blue_green": true},
+		},
+	})
+	albDefaults := GhostAppDefaults{SafeDeployment: &ghost.SafeDeployment{LoadBalancerType: "alb"}}
+	haproxyDefaults := GhostAppDefaults{SafeDeployment: &ghost.SafeDeployment{LoadBalancerType: "haproxy"}}
+
+	cases := []struct {
+		ServerVersion string
+		Defaults      GhostAppDefaults
+		Expected      []string
+	}{
+		{"", albDefaults, nil},
+		{"18.05", albDefaults, nil},
+		{"17.12", albDefaults, nil},
+		{"17.06", GhostAppDefaults{}, []string{
+			"attribute build_infos.source_container_image requires Cloud Deploy >= 17.12, the server runs 17.06",
+		}},
+		{"17.06", albDefaults, []string{
+			"attribute safe_deployment.load_balancer_type = \"alb\" requires Cloud Deploy >= 17.12, the server runs 17.06",
+			"attribute build_infos.source_container_image requires Cloud Deploy >= 17.12, the server runs 17.06",
+		}},
+		{"16.11", GhostAppDefaults{}, []string{
+			"attribute blue_green requires Cloud Deploy >= 17.03, the server runs 16.11",
+			"attribute build_infos.source_container_image requires Cloud Deploy >= 17.12, the server runs 16.11",
+		}},
+		{"16.11", haproxyDefaults, []string{
+			"attribute blue_green requires Cloud Deploy >= 17.03, the server runs 16.11",
+			"attribute safe_deployment.load_balancer_type = \"haproxy\" requires Cloud Deploy >= 17.03, the server runs 16.11",
+			"attribute build_infos.source_container_image requires Cloud Deploy >= 17.12, the server runs 16.11",
+		}},
+	}
+
+	for _, tc := range cases {
+		client := &GhostClient{ServerVersion: tc.ServerVersion, Defaults: tc.Defaults}
+		var output []string
+		for _, err := range validateGhostAppCapabilities(d, client) {
+			output = append(output, err.Error())
+		}
+		if !reflect.DeepEqual(output, tc.Expected) {
+			t.Fatalf("Unexpected output from validateGhostAppCapabilities with %s\nExpected: %#v\nGiven:    %#v",
+				tc.ServerVersion, tc.Expected, output)
+		}
+	}
+}
+
+func TestOmitUnsupportedGhostAppFields(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceGhostApp().Schema, map[string]interface{}{
+		"name": "app_name",
+		"env":  "test",
+		"build_infos": []interface{}{
+			map[string]interface{}{
+				"subnet_id":              "subnet-a7e849fe",
+				"source_container_image": "debian/9",
+			},
+		},
+	})
+
+	cases := []struct {
+		ServerVersion string
+		Expected      string
+	}{
+		{"", "debian/9"},
+		{"17.12", "debian/9"},
+		{"17.06", ""},
+	}
+
+	for _, tc := range cases {
+		app := ghost.App{BuildInfos: expandGhostAppBuildInfos(d.Get("build_infos").([]interface{}))}
+		omitUnsupportedGhostAppFields(d, &app, &GhostClient{ServerVersion: tc.ServerVersion})
+		if app.BuildInfos.SourceContainerImage != tc.Expected {
+			t.Fatalf("Unexpected output from omitUnsupportedGhostAppFields with %s\nExpected: %#v\nGiven:    %#v",
+				tc.ServerVersion, tc.Expected, app.BuildInfos.SourceContainerImage)
+		}
+	}
+}
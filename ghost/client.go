@@ -0,0 +1,233 @@
+package ghost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud-deploy.io/cloud-deploy-sdk-go"
+)
+
+// The Ghost API is called with the SDK types, but requests are sent by the
+// provider so that they can be authenticated with tokens, go through a custom
+// HTTP client, and reach the endpoints missing from the SDK.
+
+// HTTP client used when the GhostClient has none
+var ghostHTTPClient = &http.Client{
+	Timeout: time.Second * 10,
+}
+
+// Error response of the Ghost API, with the message and the issues of the
+// fields reported by Eve in its body
+type ghostAPIError struct {
+	StatusCode int
+	Message    string
+	Issues     map[string]interface{}
+}
+
+// Error response body of Eve
+type ghostAPIErrorBody struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"_error"`
+	Issues map[string]interface{} `json:"_issues"`
+}
+
+// Get the error of a response with the given status and body, which may not
+// be an Eve error document
+func newGhostAPIError(statusCode int, body []byte) *ghostAPIError {
+	apiErr := &ghostAPIError{StatusCode: statusCode}
+	var errBody ghostAPIErrorBody
+	if json.Unmarshal(body, &errBody) == nil {
+		apiErr.Message = errBody.Error.Message
+		apiErr.Issues = errBody.Issues
+	}
+	return apiErr
+}
+
+func (e *ghostAPIError) Error() string {
+	msg := fmt.Sprintf("Failed call API endpoint. HTTP response code: %v", e.StatusCode)
+	if e.Message != "" {
+		msg += ". " + e.Message
+	}
+	if issues := ghostAPIErrorIssues("", e.Issues); len(issues) > 0 {
+		msg += ". Issues: " + strings.Join(issues, "; ")
+	}
+	return msg
+}
+
+// Get the issues of an Eve error as sorted "field: issue" strings, the issues
+// of subdocuments being nested under their field
+func ghostAPIErrorIssues(prefix string, issues map[string]interface{}) []string {
+	var output []string
+	for field, issue := range issues {
+		switch v := issue.(type) {
+		case map[string]interface{}:
+			output = append(output, ghostAPIErrorIssues(prefix+field+".", v)...)
+		case []interface{}:
+			for _, i := range v {
+				output = append(output, fmt.Sprintf("%s%s: %v", prefix, field, i))
+			}
+		default:
+			output = append(output, fmt.Sprintf("%s%s: %v", prefix, field, v))
+		}
+	}
+	sort.Strings(output)
+	return output
+}
+
+// Whether an error is an error response of the Ghost API with the given status
+func isGhostAPIStatus(err error, status int) bool {
+	apiErr, ok := err.(*ghostAPIError)
+	return ok && apiErr.StatusCode == status
+}
+
+// Ghost server version
+type ghostVersion struct {
+	CurrentRevision     string `json:"current_revision"`
+	CurrentRevisionDate string `json:"current_revision_date"`
+	CurrentRevisionName string `json:"current_revision_name"`
+}
+
+// App sent to Ghost, leaving out an empty source_container_image which Ghost
+// versions without container builds reject
+type ghostAppPayload struct {
+	ghost.App
+	BuildInfos *ghostBuildInfosPayload `json:"build_infos"`
+}
+
+type ghostBuildInfosPayload struct {
+	ghost.BuildInfos
+	SourceContainerImage string `json:"source_container_image,omitempty"`
+}
+
+// Get the JSON document of an app, as sent to Ghost
+func marshalGhostApp(app ghost.App) ([]byte, error) {
+	payload := ghostAppPayload{App: app}
+	if app.BuildInfos != nil {
+		payload.BuildInfos = &ghostBuildInfosPayload{
+			BuildInfos:           *app.BuildInfos,
+			SourceContainerImage: app.BuildInfos.SourceContainerImage,
+		}
+	}
+	return json.Marshal(payload)
+}
+
+// GetApps returns the first page of apps
+func (c *GhostClient) GetApps() (apps ghost.Apps, err error) {
+	err = c.do("GET", "/apps", nil, nil, &apps)
+	return
+}
+
+// CreateApp creates a new app
+func (c *GhostClient) CreateApp(app ghost.App) (metadata ghost.EveItemMetadata, err error) {
+	data, err := marshalGhostApp(app)
+	if err != nil {
+		return
+	}
+	err = c.do("POST", "/apps", data, nil, &metadata)
+	return
+}
+
+// GetApp returns the requested app
+func (c *GhostClient) GetApp(id string) (app ghost.App, err error) {
+	err = c.do("GET", "/apps/"+id, nil, nil, &app)
+	return
+}
+
+// GetAppVersion returns the requested version of an app
+func (c *GhostClient) GetAppVersion(id string, version int64) (app ghost.App, err error) {
+	err = c.do("GET", "/apps/"+id+"?version="+strconv.FormatInt(version, 10), nil, nil, &app)
+	return
+}
+
+// UpdateApp replaces the document of an existing app
+func (c *GhostClient) UpdateApp(app *ghost.App, id string, etag string) (metadata ghost.EveItemMetadata, err error) {
+	data, err := marshalGhostApp(*app)
+	if err != nil {
+		return
+	}
+	err = c.do("PATCH", "/apps/"+id, data, map[string]string{"If-Match": etag}, &metadata)
+	return
+}
+
+// PatchApp updates the given fields of an existing app, leaving the other
+// fields untouched
+func (c *GhostClient) PatchApp(fields map[string]interface{}, id string, etag string) (metadata ghost.EveItemMetadata, err error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	err = c.do("PATCH", "/apps/"+id, data, map[string]string{"If-Match": etag}, &metadata)
+	return
+}
+
+// DeleteApp deletes an existing app
+func (c *GhostClient) DeleteApp(id string, etag string) error {
+	return c.do("DELETE", "/apps/"+id, nil, map[string]string{"If-Match": etag}, nil)
+}
+
+// GetVersion returns the version of the Ghost server
+func (c *GhostClient) GetVersion() (version ghostVersion, err error) {
+	err = c.do("GET", "/version", nil, nil, &version)
+	return
+}
+
+// CheckCredentials calls a cheap endpoint requiring authentication, to check
+// that the server is reachable and accepts the credentials
+func (c *GhostClient) CheckCredentials() error {
+	return c.do("GET", "/apps?max_results=1", nil, nil, nil)
+}
+
+// Send a request with the given JSON body, decoding the JSON response into
+// result unless it's nil. The request is sent again once with refreshed
+// credentials if they're rejected.
+func (c *GhostClient) do(method, path string, body []byte, headers map[string]string, result interface{}) error {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = ghostHTTPClient
+	}
+	refresher, refreshable := c.Auth.(Refresher)
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, c.Endpoint+path, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("Error calling the API endpoint: %v", err)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if err := c.Auth.Authenticate(req); err != nil {
+			return fmt.Errorf("Error authenticating the request: %v", err)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("Error calling the API endpoint: %v", err)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && refreshable && attempt == 0 {
+			resp.Body.Close()
+			if err := refresher.Refresh(); err != nil {
+				return fmt.Errorf("Error refreshing the credentials: %v", err)
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			body, _ := ioutil.ReadAll(resp.Body)
+			return newGhostAPIError(resp.StatusCode, body)
+		}
+		if result == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+}
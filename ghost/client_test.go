@@ -0,0 +1,168 @@
+package ghost
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud-deploy.io/cloud-deploy-sdk-go"
+)
+
+// Test requests are sent again once with a refreshed token when it's rejected
+func TestGhostClientTokenRefresh(t *testing.T) {
+	cases := []struct {
+		Tokens           []string
+		Refreshable      bool
+		ExpectedRequests int
+		ExpectedError    string
+	}{
+		{[]string{"valid"}, true, 1, ""},
+		{[]string{"expired", "valid"}, true, 2, ""},
+		{[]string{"expired", "expired", "valid"}, true, 2, "HTTP response code: 401"},
+		{[]string{"expired"}, true, 1, "Error refreshing the credentials"},
+		{[]string{"expired", "valid"}, false, 1, "HTTP response code: 401"},
+	}
+
+	for _, tc := range cases {
+		requests, bodies := 0, []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			if r.Header.Get("Authorization") != "Bearer valid" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"_id": "5a5f2f2f2f2f2f2f2f2f2f2f"}`)
+		}))
+
+		fetched := 0
+		tokens := NewTokenSource(func() (string, error) {
+			if fetched == len(tc.Tokens) {
+				return "", fmt.Errorf("no token left")
+			}
+			fetched++
+			return tc.Tokens[fetched-1], nil
+		})
+		client := &GhostClient{Endpoint: server.URL, Auth: tokens}
+		if !tc.Refreshable {
+			client.Auth = BearerToken(tc.Tokens[0])
+		}
+
+		metadata, err := client.CreateApp(ghost.App{Name: "wordpress", Env: "prod", Role: "webfront"})
+		server.Close()
+
+		if tc.ExpectedError == "" && (err != nil || metadata.ID != "5a5f2f2f2f2f2f2f2f2f2f2f") {
+			t.Fatalf("Unexpected output from CreateApp with tokens %v: %#v, %v", tc.Tokens, metadata, err)
+		}
+		if tc.ExpectedError != "" && (err == nil || !strings.Contains(err.Error(), tc.ExpectedError)) {
+			t.Fatalf("Unexpected error from CreateApp with tokens %v\nExpected: %q\nGiven:    %v",
+				tc.Tokens, tc.ExpectedError, err)
+		}
+		if requests != tc.ExpectedRequests {
+			t.Fatalf("Unexpected number of requests with tokens %v\nExpected: %d\nGiven:    %d",
+				tc.Tokens, tc.ExpectedRequests, requests)
+		}
+		for _, body := range bodies {
+			if body != bodies[0] || !strings.Contains(body, `"name":"wordpress"`) {
+				t.Fatalf("Unexpected request bodies with tokens %v: %q", tc.Tokens, bodies)
+			}
+		}
+	}
+}
+
+func TestIsGhostAPIStatus(t *testing.T) {
+	cases := []struct {
+		Err      error
+		Status   int
+		Expected bool
+	}{
+		{&ghostAPIError{StatusCode: 412}, http.StatusPreconditionFailed, true},
+		{&ghostAPIError{StatusCode: 404}, http.StatusPreconditionFailed, false},
+		{fmt.Errorf("Failed call API endpoint. HTTP response code: 412"), http.StatusPreconditionFailed, false},
+		{fmt.Errorf("EOF"), http.StatusPreconditionFailed, false},
+		{nil, http.StatusPreconditionFailed, false},
+	}
+
+	for _, tc := range cases {
+		if output := isGhostAPIStatus(tc.Err, tc.Status); output != tc.Expected {
+			t.Fatalf("Unexpected output from isGhostAPIStatus for %#v: %v", tc.Err, output)
+		}
+	}
+}
+
+// Test the message and issues of Eve error responses are part of the error
+func TestGhostClientAPIError(t *testing.T) {
+	cases := []struct {
+		StatusCode int
+		Body       string
+		Expected   string
+	}{
+		{
+			http.StatusUnprocessableEntity,
+			`{"_status": "ERR", "_error": {"code": 422, "message": "Insertion failure: 1 document(s) contain(s) error(s)"},
+			"_issues": {"name": "required field", "modules": {"0": {"scope": ["unallowed value bad", "required field"]}}}}`,
+			"Failed call API endpoint. HTTP response code: 422. Insertion failure: 1 document(s) contain(s) error(s). " +
+				"Issues: modules.0.scope: required field; modules.0.scope: unallowed value bad; name: required field",
+		},
+		{
+			http.StatusPreconditionFailed,
+			`{"_status": "ERR", "_error": {"code": 412, "message": "Client and server etags don't match"}}`,
+			"Failed call API endpoint. HTTP response code: 412. Client and server etags don't match",
+		},
+		{
+			http.StatusBadGateway,
+			"<html>Bad Gateway</html>",
+			"Failed call API endpoint. HTTP response code: 502",
+		},
+		{
+			http.StatusNotFound,
+			"",
+			"Failed call API endpoint. HTTP response code: 404",
+		},
+	}
+
+	for _, tc := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.StatusCode)
+			fmt.Fprint(w, tc.Body)
+		}))
+		client := &GhostClient{Endpoint: server.URL, Auth: BasicAuth{Username: "ghost", Password: "ghost"}}
+		_, err := client.CreateApp(ghost.App{Name: "wordpress", Env: "prod", Role: "webfront"})
+		server.Close()
+
+		if err == nil || err.Error() != tc.Expected {
+			t.Fatalf("Unexpected error from CreateApp with body %q\nExpected: %q\nGiven:    %v", tc.Body, tc.Expected, err)
+		}
+		if !isGhostAPIStatus(err, tc.StatusCode) {
+			t.Fatalf("Unexpected status of the error from CreateApp with body %q: %#v", tc.Body, err)
+		}
+	}
+}
+
+func TestMarshalGhostApp(t *testing.T) {
+	cases := []struct {
+		BuildInfos *ghost.BuildInfos
+		Expected   string
+	}{
+		{nil, `"build_infos":null`},
+		{&ghost.BuildInfos{SourceAmi: "ami-1"},
+			`"build_infos":{"source_ami":"ami-1","ssh_username":"","subnet_id":""}`},
+		{&ghost.BuildInfos{SourceContainerImage: "debian:9"},
+			`"build_infos":{"source_ami":"","ssh_username":"","subnet_id":"","source_container_image":"debian:9"}`},
+	}
+
+	for _, tc := range cases {
+		data, err := marshalGhostApp(ghost.App{Name: "wordpress", BuildInfos: tc.BuildInfos})
+		if err != nil {
+			t.Fatalf("Unexpected error from marshalGhostApp: %v", err)
+		}
+		if !strings.Contains(string(data), tc.Expected) || !strings.Contains(string(data), `"name":"wordpress"`) {
+			t.Fatalf("Unexpected output from marshalGhostApp.\nExpected: %s\nGiven:    %s", tc.Expected, data)
+		}
+	}
+}
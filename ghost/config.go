@@ -3,32 +3,168 @@ package ghost
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
+	"regexp"
 
 	"cloud-deploy.io/cloud-deploy-sdk-go"
 )
 
 // Config defines the configuration options for the Ghost client
 type Config struct {
-	User     string
-	Password string
-	URL      string
+	User                string
+	Password            string
+	URL                 string
+	FullDocumentUpdates bool
+
+	// Bearer token authentication, only one of them can be set instead of
+	// User and Password
+	Token        string
+	TokenFile    string
+	TokenCommand string
+
+	// Instance tags added to every app which doesn't set them
+	DefaultInstanceTags map[string]string
+
+	// Values used for the app attributes left empty
+	Defaults GhostAppDefaults
+
+	// Profile of the credentials file filling the settings left empty
+	Profile         string
+	CredentialsFile string
+}
+
+// GhostClient is the Ghost client along with the provider settings
+type GhostClient struct {
+	Endpoint string
+
+	// Authenticator of the requests
+	Auth Authenticator
+
+	// HTTP client used to call the API, a default one is used if nil
+	HTTPClient *http.Client
+
+	// Send the whole app document on updates instead of the changed fields
+	FullDocumentUpdates bool
+
+	// Instance tags added to every app which doesn't set them
+	DefaultInstanceTags map[string]string
+
+	// Values used for the app attributes left empty
+	Defaults GhostAppDefaults
+
+	// Version of the Ghost server, e.g. 18.05, empty when unknown
+	ServerVersion string
+}
+
+// Version number in the Ghost revision names, e.g. v18.05.1
+var ghostVersionRegexp = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// GhostAppDefaults are the values of the app attributes which can be set for
+// all apps by the provider, nil or empty when not set
+type GhostAppDefaults struct {
+	Region           string
+	VpcID            string
+	LogNotifications []string
+	SafeDeployment   *ghost.SafeDeployment
 }
 
 // Client returns a new Ghost client
-func (c *Config) Client() (*ghost.Client, error) {
-	if c.Password == "" || c.User == "" || c.URL == "" {
-		return nil, fmt.Errorf(`At least 1 ghost parameter is empty: Username: %s,
-			 Password, URL: %s`, c.User, c.URL)
+func (c *Config) Client() (*GhostClient, error) {
+	if err := c.loadProfile(); err != nil {
+		return nil, err
+	}
+
+	if c.URL == "" {
+		return nil, fmt.Errorf("The ghost endpoint is empty")
 	}
 
 	if _, err := url.ParseRequestURI(c.URL); err != nil {
 		return nil, fmt.Errorf("Invalid endpoint URL")
 	}
 
-	client := ghost.NewClient(c.URL, c.User, c.Password)
+	auth, err := c.authenticator()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &GhostClient{
+		Endpoint:            c.URL,
+		Auth:                auth,
+		FullDocumentUpdates: c.FullDocumentUpdates,
+		DefaultInstanceTags: c.DefaultInstanceTags,
+		Defaults:            c.Defaults,
+	}
 
-	log.Printf("[INFO] Ghost client configured: %s %s", c.User, c.URL)
+	log.Printf("[INFO] Ghost client configured: %s %s", c.identity(), c.URL)
 
 	return client, nil
 }
+
+// Check that Ghost is reachable and accepts the credentials, so that errors
+// show when configuring the provider instead of on the first resource, and get
+// its version
+func (c *GhostClient) checkServer() error {
+	if err := c.CheckCredentials(); err != nil {
+		if isGhostAPIStatus(err, http.StatusUnauthorized) {
+			return fmt.Errorf("Ghost at %s rejected the credentials, check the user and password or the token", c.Endpoint)
+		}
+		return fmt.Errorf("Error connecting to Ghost at %s: %v", c.Endpoint, err)
+	}
+
+	// Older Ghost versions have no version endpoint
+	version, err := c.GetVersion()
+	if err != nil {
+		log.Printf("[WARN] Error getting the ghost version: %v", err)
+		return nil
+	}
+	c.ServerVersion = ghostVersionRegexp.FindString(version.CurrentRevisionName)
+	if c.ServerVersion == "" {
+		log.Printf("[WARN] Unknown ghost version: %s", version.CurrentRevisionName)
+		return nil
+	}
+	log.Printf("[INFO] Ghost version: %s", c.ServerVersion)
+
+	return nil
+}
+
+// Return the authenticator matching the credentials, which must be either a
+// user and a password, or a single kind of token
+func (c *Config) authenticator() (Authenticator, error) {
+	tokens := 0
+	for _, token := range []string{c.Token, c.TokenFile, c.TokenCommand} {
+		if token != "" {
+			tokens++
+		}
+	}
+
+	switch {
+	case tokens > 1:
+		return nil, fmt.Errorf("Only one of the ghost token, token_file and token_command parameters can be set")
+	case tokens == 1 && (c.User != "" || c.Password != ""):
+		return nil, fmt.Errorf("The ghost user and password parameters can't be set along with a token")
+	case c.Token != "":
+		return BearerToken(c.Token), nil
+	case c.TokenFile != "":
+		return NewFileTokenSource(c.TokenFile), nil
+	case c.TokenCommand != "":
+		return NewCommandTokenSource(c.TokenCommand), nil
+	case c.User == "" || c.Password == "":
+		return nil, fmt.Errorf("Either the ghost user and password, or one of the token, token_file and token_command parameters must be set")
+	}
+
+	return BasicAuth{Username: c.User, Password: c.Password}, nil
+}
+
+// Describe the credentials used, for logging
+func (c *Config) identity() string {
+	switch {
+	case c.Token != "":
+		return "token"
+	case c.TokenFile != "":
+		return "token file " + c.TokenFile
+	case c.TokenCommand != "":
+		return "token command"
+	}
+	return c.User
+}
@@ -1,15 +1,26 @@
 package ghost
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"cloud-deploy.io/cloud-deploy-sdk-go"
+	"cloud-deploy.io/terraform-provider-cloud-deploy/ghost/ghosttest"
 )
 
-// Test config with empty parameters
+// Test config with empty parameters, ignoring any credentials file
 func TestConfigEmptyParameters(t *testing.T) {
 	config := Config{
 		User:     "",
 		Password: "",
 		URL:      "",
+
+		CredentialsFile: os.DevNull,
 	}
 
 	if _, err := config.Client(); err == nil {
@@ -42,3 +53,152 @@ func TestConfigValidParameters(t *testing.T) {
 		t.Fatalf("expected no error, but got %s", err)
 	}
 }
+
+// Test config with the different kinds of credentials
+func TestConfigCredentials(t *testing.T) {
+	cases := []struct {
+		Config Config
+		Valid  bool
+	}{
+		{Config{User: "myuser", Password: "mypwd"}, true},
+		{Config{User: "myuser"}, false},
+		{Config{Password: "mypwd"}, false},
+		{Config{Token: "mytoken"}, true},
+		{Config{TokenFile: "/path/to/token"}, true},
+		{Config{TokenCommand: "echo mytoken"}, true},
+		{Config{Token: "mytoken", TokenFile: "/path/to/token"}, false},
+		{Config{TokenFile: "/path/to/token", TokenCommand: "echo mytoken"}, false},
+		{Config{User: "myuser", Token: "mytoken"}, false},
+		{Config{User: "myuser", Password: "mypwd", TokenCommand: "echo mytoken"}, false},
+	}
+
+	for _, tc := range cases {
+		tc.Config.URL = "https://www.valid.url"
+		if _, err := tc.Config.Client(); (err == nil) != tc.Valid {
+			t.Fatalf("Unexpected output from Client with %#v\nExpected valid: %t\nGiven error: %v", tc.Config, tc.Valid, err)
+		}
+	}
+}
+
+// Test clients authenticating with tokens against the fake Ghost API
+func TestConfigTokenAuthentication(t *testing.T) {
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "ghost-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte(ghosttest.Token+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Config Config
+		Valid  bool
+	}{
+		{Config{Token: ghosttest.Token}, true},
+		{Config{Token: "invalid"}, false},
+		{Config{TokenFile: tokenFile}, true},
+		{Config{TokenFile: filepath.Join(dir, "missing")}, false},
+		{Config{TokenCommand: "cat " + tokenFile}, true},
+		{Config{TokenCommand: "echo invalid"}, false},
+		{Config{TokenCommand: "exit 1"}, false},
+	}
+
+	for _, tc := range cases {
+		tc.Config.URL = server.URL
+		client, err := tc.Config.Client()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetApps(); (err == nil) != tc.Valid {
+			t.Fatalf("Unexpected output from GetApps with %#v\nExpected valid: %t\nGiven error: %v", tc.Config, tc.Valid, err)
+		}
+	}
+}
+
+// Test a token read from a file is read again when it's rejected
+func TestConfigTokenRefresh(t *testing.T) {
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "ghost-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("expired"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{URL: server.URL, TokenFile: tokenFile}
+	client, err := config.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetApps(); err == nil {
+		t.Fatalf("expected error with an expired token, but got nil")
+	}
+
+	if err := ioutil.WriteFile(tokenFile, []byte(ghosttest.Token), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateApp(ghost.App{Name: "wordpress", Env: "prod", Role: "webfront"}); err != nil {
+		t.Fatalf("expected no error after the token was renewed, but got %s", err)
+	}
+}
+
+// Test the endpoint and credentials check, and the detected server version
+func TestGhostClientCheckServer(t *testing.T) {
+	withoutVersion := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		ghosttest.NewHandler(ghosttest.Options{}).ServeHTTP(w, r)
+	})
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	cases := []struct {
+		Handler         http.Handler
+		URL             string
+		Password        string
+		ExpectedVersion string
+		ExpectedError   string
+	}{
+		{ghosttest.NewHandler(ghosttest.Options{}), "", ghosttest.Password, ghosttest.Version, ""},
+		{ghosttest.NewHandler(ghosttest.Options{Version: "v17.12.2"}), "", ghosttest.Password, "17.12.2", ""},
+		{ghosttest.NewHandler(ghosttest.Options{Version: "master"}), "", ghosttest.Password, "", ""},
+		{withoutVersion, "", ghosttest.Password, "", ""},
+		{ghosttest.NewHandler(ghosttest.Options{}), "", "invalid", "", "rejected the credentials"},
+		{nil, unreachable.URL, ghosttest.Password, "", "Error connecting to Ghost"},
+	}
+
+	for _, tc := range cases {
+		url := tc.URL
+		if tc.Handler != nil {
+			server := httptest.NewServer(tc.Handler)
+			defer server.Close()
+			url = server.URL
+		}
+
+		config := Config{User: ghosttest.Username, Password: tc.Password, URL: url, CredentialsFile: os.DevNull}
+		client, err := config.Client()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = client.checkServer()
+		if tc.ExpectedError == "" && err != nil || tc.ExpectedError != "" && (err == nil || !strings.Contains(err.Error(), tc.ExpectedError)) {
+			t.Fatalf("Unexpected error from checkServer with %s\nExpected: %q\nGiven:    %v", tc.Password, tc.ExpectedError, err)
+		}
+		if client.ServerVersion != tc.ExpectedVersion {
+			t.Fatalf("Unexpected server version from checkServer\nExpected: %#v\nGiven:    %#v", tc.ExpectedVersion, client.ServerVersion)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ghost
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/go-ini/ini"
+	"github.com/mitchellh/go-homedir"
+)
+
+// Path of the credentials file used when none is configured
+const defaultCredentialsFile = "~/.ghost/credentials"
+
+// Profile used when none is configured, only if the credentials file exists
+const defaultProfile = "default"
+
+// Fill the settings left empty by the provider arguments and environment
+// variables with the ones of the profile from the credentials file, e.g.:
+//
+//	[prod]
+//	endpoint = https://ghost.example.com
+//	user     = myuser
+//	password = mypwd
+//
+// Credentials are taken from the profile only if none are set otherwise, so
+// that they're never mixed. A missing file or profile is only an error if
+// they're explicitly configured.
+func (c *Config) loadProfile() error {
+	path := c.CredentialsFile
+	if path == "" {
+		path = defaultCredentialsFile
+	}
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return fmt.Errorf("Error expanding the ghost credentials file path: %v", err)
+	}
+
+	profile := c.Profile
+	if profile == "" {
+		profile = defaultProfile
+	}
+	explicit := c.Profile != "" || c.CredentialsFile != ""
+
+	if _, err := os.Stat(path); os.IsNotExist(err) && !explicit {
+		return nil
+	}
+	file, err := ini.Load(path)
+	if err != nil {
+		return fmt.Errorf("Error loading the ghost credentials file %s: %v", path, err)
+	}
+
+	section, err := file.GetSection(profile)
+	if err != nil {
+		if c.Profile == "" {
+			return nil
+		}
+		return fmt.Errorf("Profile %s not found in the ghost credentials file %s", profile, path)
+	}
+	log.Printf("[INFO] Using ghost profile %s from %s", profile, path)
+
+	if c.URL == "" {
+		c.URL = section.Key("endpoint").String()
+	}
+	if c.User == "" && c.Password == "" && c.Token == "" && c.TokenFile == "" && c.TokenCommand == "" {
+		c.User = section.Key("user").String()
+		c.Password = section.Key("password").String()
+		c.Token = section.Key("token").String()
+		c.TokenFile = section.Key("token_file").String()
+		c.TokenCommand = section.Key("token_command").String()
+	}
+
+	return nil
+}
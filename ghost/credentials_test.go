@@ -0,0 +1,129 @@
+package ghost
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testCredentialsFile = `
+[default]
+endpoint = https://dev.ghost.example.com
+user     = devuser
+password = devpwd
+
+[prod]
+endpoint = https://ghost.example.com
+user     = produser
+password = prodpwd
+
+[sso]
+endpoint      = https://sso.ghost.example.com
+token_command = sso-cli token
+`
+
+func TestConfigLoadProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghost-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials")
+	if err := ioutil.WriteFile(path, []byte(testCredentialsFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	noDefaultPath := filepath.Join(dir, "no_default")
+	if err := ioutil.WriteFile(noDefaultPath, []byte("[prod]\nuser = produser\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missingPath := filepath.Join(dir, "missing")
+
+	cases := []struct {
+		Config   Config
+		Expected Config
+		Error    bool
+	}{
+		// The default profile is used if none is set
+		{
+			Config{CredentialsFile: path},
+			Config{CredentialsFile: path, URL: "https://dev.ghost.example.com", User: "devuser", Password: "devpwd"},
+			false,
+		},
+		{
+			Config{CredentialsFile: path, Profile: "prod"},
+			Config{CredentialsFile: path, Profile: "prod", URL: "https://ghost.example.com", User: "produser", Password: "prodpwd"},
+			false,
+		},
+		// Arguments and environment variables take precedence
+		{
+			Config{CredentialsFile: path, Profile: "prod", URL: "http://localhost"},
+			Config{CredentialsFile: path, Profile: "prod", URL: "http://localhost", User: "produser", Password: "prodpwd"},
+			false,
+		},
+		{
+			Config{CredentialsFile: path, Profile: "prod", User: "myuser", Password: "mypwd"},
+			Config{CredentialsFile: path, Profile: "prod", URL: "https://ghost.example.com", User: "myuser", Password: "mypwd"},
+			false,
+		},
+		// Credentials are never mixed
+		{
+			Config{CredentialsFile: path, Profile: "prod", Token: "mytoken"},
+			Config{CredentialsFile: path, Profile: "prod", URL: "https://ghost.example.com", Token: "mytoken"},
+			false,
+		},
+		{
+			Config{CredentialsFile: path, Profile: "sso"},
+			Config{CredentialsFile: path, Profile: "sso", URL: "https://sso.ghost.example.com", TokenCommand: "sso-cli token"},
+			false,
+		},
+		// A missing default profile is ignored, but not a missing profile
+		{
+			Config{CredentialsFile: noDefaultPath, User: "myuser"},
+			Config{CredentialsFile: noDefaultPath, User: "myuser"},
+			false,
+		},
+		{
+			Config{CredentialsFile: path, Profile: "missing"},
+			Config{},
+			true,
+		},
+		{
+			Config{CredentialsFile: missingPath},
+			Config{},
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		config := tc.Config
+		err := config.loadProfile()
+		if (err != nil) != tc.Error {
+			t.Fatalf("Unexpected error from loadProfile with %#v\nExpected error: %t\nGiven:    %v", tc.Config, tc.Error, err)
+		}
+		if err == nil && !reflect.DeepEqual(config, tc.Expected) {
+			t.Fatalf("Unexpected output from loadProfile.\nExpected: %#v\nGiven:    %#v", tc.Expected, config)
+		}
+	}
+}
+
+// Test a client is configured from a profile alone
+func TestConfigProfileClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghost-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials")
+	if err := ioutil.WriteFile(path, []byte(testCredentialsFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{CredentialsFile: path, Profile: "prod"}
+	if _, err := config.Client(); err != nil {
+		t.Fatalf("expected no error, but got %s", err)
+	}
+}
@@ -0,0 +1,114 @@
+package ghosttest
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Statuses of a job, from its creation to its end
+const (
+	JobInit    = "init"
+	JobStarted = "started"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+func (h *Handler) checkJob(fields map[string]interface{}) map[string]string {
+	issues := map[string]string{}
+	if id, ok := fields["app_id"].(string); ok && id != "" && h.resources["apps"].items[id] == nil {
+		issues["app_id"] = "value '" + id + "' must exist in resource 'apps', field '_id'."
+	}
+	return issues
+}
+
+// Start a job created by a Ghost client, which ends after the job duration
+func (h *Handler) startJob(id string) {
+	jobs := h.resources["jobs"]
+	job := jobs.latest(id)
+	if status, _ := job["status"].(string); status != "" && status != JobInit {
+		return
+	}
+
+	jobs.update(id, map[string]interface{}{"status": JobStarted, "message": "Job started"}, Username)
+	h.scheduleJob(id)
+}
+
+func (h *Handler) scheduleJob(id string) {
+	if h.options.JobDuration <= 0 {
+		h.endJob(id)
+		return
+	}
+
+	time.AfterFunc(h.options.JobDuration, func() {
+		h.change(func() {
+			h.endJob(id)
+		})
+	})
+}
+
+// End a started job, either successfully or not following the failure rate
+func (h *Handler) endJob(id string) {
+	jobs := h.resources["jobs"]
+	if jobs.items[id] == nil {
+		return
+	}
+	job := jobs.latest(id)
+	if job["status"] != JobStarted {
+		return
+	}
+
+	if h.options.JobFailureRate > 0 && rand.Float64() < h.options.JobFailureRate {
+		jobs.update(id, map[string]interface{}{"status": JobFailed, "message": "Simulated job failure"}, Username)
+		return
+	}
+	jobs.update(id, map[string]interface{}{"status": JobDone, "message": "Job done"}, Username)
+
+	if job["command"] == "deploy" {
+		h.deployed(id, job)
+	}
+}
+
+// Mark the modules deployed by a job as initialized, and the app as having
+// no more pending changes
+func (h *Handler) deployed(id string, job document) {
+	appID, _ := job["app_id"].(string)
+	apps := h.resources["apps"]
+	if apps.items[appID] == nil {
+		return
+	}
+
+	names := map[string]bool{}
+	if deployed, ok := job["modules"].([]interface{}); ok {
+		for _, m := range deployed {
+			if m, ok := m.(map[string]interface{}); ok {
+				name, _ := m["name"].(string)
+				names[name] = true
+			}
+		}
+	}
+
+	fields := map[string]interface{}{"pending_changes": []interface{}{}}
+	if current, ok := apps.latest(appID)["modules"].([]interface{}); ok {
+		modules := []interface{}{}
+		for _, m := range current {
+			module, ok := m.(map[string]interface{})
+			if !ok {
+				modules = append(modules, m)
+				continue
+			}
+
+			updated := map[string]interface{}{}
+			for k, v := range module {
+				updated[k] = v
+			}
+			if name, _ := module["name"].(string); len(names) == 0 || names[name] {
+				updated["initialized"] = true
+				updated["last_deployment"] = id
+			}
+			modules = append(modules, updated)
+		}
+		fields["modules"] = modules
+	}
+
+	apps.update(appID, fields, Username)
+}
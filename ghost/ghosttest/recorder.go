@@ -0,0 +1,236 @@
+package ghosttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+)
+
+// Endpoint to configure the Ghost client with when replaying a cassette
+const ReplayEndpoint = "http://ghost.invalid"
+
+// Value replacing the credentials in cassettes
+const redacted = "REDACTED"
+
+// Recorder is an http.RoundTripper recording the interactions with a Ghost
+// API to a cassette file, or replaying them
+type Recorder struct {
+	path      string
+	recording bool
+	endpoint  string
+	username  string
+	password  string
+	transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette cassette
+	replayed map[int]bool
+}
+
+type cassette struct {
+	// Random strings used in the recorded requests, e.g. in names
+	Random       []string      `json:"random"`
+	Interactions []interaction `json:"interactions"`
+}
+
+type interaction struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+		Body   string `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Code        int    `json:"code"`
+		ContentType string `json:"content_type,omitempty"`
+		Body        string `json:"body,omitempty"`
+	} `json:"response"`
+}
+
+// NewRecorder returns a recorder of the interactions with the Ghost API at
+// endpoint, to be saved to the cassette file without the given credentials
+func NewRecorder(path string, endpoint string, username string, password string) *Recorder {
+	return &Recorder{
+		path:      path,
+		recording: true,
+		endpoint:  endpoint,
+		username:  username,
+		password:  password,
+		transport: http.DefaultTransport,
+	}
+}
+
+// LoadRecorder returns a recorder replaying the interactions of a cassette
+// file, for a Ghost client configured with ReplayEndpoint and the Username
+// and Password credentials
+func LoadRecorder(path string) (*Recorder, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		path:     path,
+		endpoint: ReplayEndpoint,
+		username: Username,
+		password: Password,
+		replayed: map[int]bool{},
+	}
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %v", path, err)
+	}
+
+	return r, nil
+}
+
+// Recording returns whether interactions are recorded rather than replayed
+func (r *Recorder) Recording() bool {
+	return r.recording
+}
+
+// RandString returns a random string when recording, or the one used at the
+// same point of the recording when replaying
+func (r *Recorder) RandString(n int) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.recording && len(r.cassette.Random) > 0 {
+		s := r.cassette.Random[0]
+		r.cassette.Random = r.cassette.Random[1:]
+		return s
+	}
+
+	s := acctest.RandString(n)
+	if r.recording {
+		r.cassette.Random = append(r.cassette.Random, s)
+	}
+	return s
+}
+
+// RoundTrip records or replays an interaction
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	url := strings.TrimPrefix(req.URL.String(), r.endpoint)
+
+	if !r.recording {
+		return r.replay(req, url, r.scrub(body))
+	}
+
+	res, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	i := interaction{}
+	i.Request.Method = req.Method
+	i.Request.URL = url
+	i.Request.Body = r.scrub(body)
+	i.Response.Code = res.StatusCode
+	i.Response.ContentType = res.Header.Get("Content-Type")
+	i.Response.Body = r.scrub(resBody)
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	r.mu.Unlock()
+
+	return res, nil
+}
+
+// Return the first interaction not replayed yet with the same method, URL and
+// body, the body being compared once scrubbed as in the cassette
+func (r *Recorder) replay(req *http.Request, url string, body string) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for n, i := range r.cassette.Interactions {
+		if r.replayed[n] || i.Request.Method != req.Method || i.Request.URL != url || i.Request.Body != body {
+			continue
+		}
+		r.replayed[n] = true
+
+		header := http.Header{}
+		if i.Response.ContentType != "" {
+			header.Set("Content-Type", i.Response.ContentType)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", i.Response.Code, http.StatusText(i.Response.Code)),
+			StatusCode:    i.Response.Code,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(i.Response.Body)),
+			ContentLength: int64(len(i.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("no interaction left to replay for %s %s with body %s in cassette %s",
+		req.Method, url, body, r.path)
+}
+
+// Save writes the recorded interactions to the cassette file
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, append(data, '\n'), 0644)
+}
+
+// Replace the password, and the username in user fields, of a JSON body,
+// which is re-encoded with sorted keys
+func (r *Recorder) scrub(body []byte) string {
+	var value interface{}
+	if len(body) == 0 || json.Unmarshal(body, &value) != nil {
+		return string(body)
+	}
+
+	scrubbed, _ := json.Marshal(r.scrubValue("", value))
+	return string(scrubbed)
+}
+
+func (r *Recorder) scrubValue(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if v == r.password || key == "user" && v == r.username {
+			return redacted
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = r.scrubValue(k, item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = r.scrubValue("", item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,83 @@
+package ghosttest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cloud-deploy.io/cloud-deploy-sdk-go"
+)
+
+func TestRecorder(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	dir, _ := ioutil.TempDir("", "ghosttest")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassettes", "TestRecorder.json")
+
+	// Record
+	recorder := NewRecorder(path, s.URL, Username, Password)
+	client := &http.Client{Transport: recorder}
+
+	name := recorder.RandString(10)
+	body, _ := json.Marshal(testApp(name))
+	var metadata ghost.EveItemMetadata
+	if code := testRequest(t, client, "POST", s.URL+"/apps", string(body), nil, &metadata); code != http.StatusCreated {
+		t.Fatalf("Unexpected response creating app: %d", code)
+	}
+	if code := testRequest(t, client, "GET", s.URL+"/apps/"+metadata.ID, "", nil, nil); code != http.StatusOK {
+		t.Fatalf("Unexpected response reading app: %d", code)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Unexpected error saving cassette: %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(data), `"user":"`+Username+`"`) || !strings.Contains(string(data), name) {
+		t.Fatalf("Unexpected cassette: %s", data)
+	}
+
+	// Replay, without any server
+	replayer, err := LoadRecorder(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading cassette: %v", err)
+	}
+	client = &http.Client{Transport: replayer}
+
+	if replayed := replayer.RandString(10); replayed != name {
+		t.Fatalf("Unexpected replayed random string: %s, expected %s", replayed, name)
+	}
+	// Requests with another body don't replay the interaction
+	other, _ := json.Marshal(testApp(name + "_other"))
+	req, _ := http.NewRequest("POST", ReplayEndpoint+"/apps", strings.NewReader(string(other)))
+	if _, err := client.Do(req); err == nil || !strings.Contains(err.Error(), "no interaction left") {
+		t.Fatalf("Expected error replaying an interaction with another body, got %v", err)
+	}
+
+	// Bodies are matched whatever the order of their keys
+	var fields map[string]interface{}
+	json.Unmarshal(body, &fields)
+	sorted, _ := json.Marshal(fields)
+
+	var replayed ghost.EveItemMetadata
+	if code := testRequest(t, client, "POST", ReplayEndpoint+"/apps", string(sorted), nil,
+		&replayed); code != http.StatusCreated || replayed.ID != metadata.ID {
+		t.Fatalf("Unexpected replayed app creation: %d %#v", code, replayed)
+	}
+	var app ghost.App
+	if code := testRequest(t, client, "GET", ReplayEndpoint+"/apps/"+metadata.ID, "", nil,
+		&app); code != http.StatusOK || app.Name != name || app.User != redacted {
+		t.Fatalf("Unexpected replayed app: %d %#v", code, app)
+	}
+
+	// Interactions are only replayed once
+	req, _ = http.NewRequest("GET", ReplayEndpoint+"/apps/"+metadata.ID, nil)
+	if _, err := client.Do(req); err == nil || !strings.Contains(err.Error(), "no interaction left") {
+		t.Fatalf("Expected error replaying an interaction twice, got %v", err)
+	}
+}
@@ -0,0 +1,600 @@
+// Package ghosttest provides an in-process fake of the Ghost API, with the Eve
+// semantics the provider relies on, so that the provider can be tested without
+// a Ghost instance.
+package ghosttest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials accepted by the fake server
+const (
+	Username = "ghost"
+	Password = "ghost"
+	Token    = "ghost-token"
+)
+
+// Default number of items per page of a collection
+const defaultMaxResults = 25
+
+// Version reported by default by the fake server
+const Version = "18.05"
+
+// Options of a fake Ghost API
+type Options struct {
+	// Time taken by jobs to run once started, they end right away when zero
+	JobDuration time.Duration
+
+	// Probability, between 0 and 1, for a job to fail
+	JobFailureRate float64
+
+	// Probability, between 0 and 1, for a request to fail with a 500 error
+	ErrorRate float64
+
+	// Version reported by the version endpoint, Version when empty
+	Version string
+
+	// Called after each change of the stored items, outside of any request
+	// processing so that it can Dump them
+	OnChange func()
+}
+
+// Handler serves a fake Ghost API
+type Handler struct {
+	options Options
+
+	mu        sync.Mutex
+	resources map[string]*collection
+	lastID    int
+}
+
+// Server is a fake Ghost API server
+type Server struct {
+	*httptest.Server
+	*Handler
+}
+
+type document map[string]interface{}
+
+type collection struct {
+	title    string
+	required []string
+
+	// Returns the issues of the fields of an item to insert, if any
+	check func(fields map[string]interface{}) map[string]string
+
+	// Versions of each item, the last one being the latest
+	items map[string][]document
+	ids   []string
+
+	// Number of changes made to the items
+	changes int
+}
+
+// NewServer starts a fake Ghost API server, which must be closed once done
+func NewServer() *Server {
+	return NewServerWithOptions(Options{})
+}
+
+// NewServerWithOptions starts a fake Ghost API server with the given options,
+// which must be closed once done
+func NewServerWithOptions(options Options) *Server {
+	h := NewHandler(options)
+
+	return &Server{
+		Server:  httptest.NewServer(h),
+		Handler: h,
+	}
+}
+
+// NewHandler returns an empty fake Ghost API
+func NewHandler(options Options) *Handler {
+	h := &Handler{
+		options: options,
+		resources: map[string]*collection{
+			"apps": newCollection("App", "name", "env", "role"),
+			"jobs": newCollection("Job", "command", "app_id"),
+		},
+	}
+	h.resources["jobs"].check = h.checkJob
+
+	return h
+}
+
+func newCollection(title string, required ...string) *collection {
+	return &collection{
+		title:    title,
+		required: required,
+		items:    map[string][]document{},
+	}
+}
+
+// IDs returns the IDs of the items of a resource, in creation order
+func (h *Handler) IDs(resource string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]string{}, h.resources[resource].ids...)
+}
+
+// Get returns the latest version of an item, along with its Eve metadata
+func (h *Handler) Get(resource string, id string) (map[string]interface{}, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c, ok := h.resources[resource]
+	if !ok || c.items[id] == nil {
+		return nil, fmt.Errorf("%s %s not found", resource, id)
+	}
+
+	return c.item(resource, id, c.latest(id)), nil
+}
+
+// Insert adds an item as if it was posted by a Ghost client, keeping its _id
+// if any, and returns its ID
+func (h *Handler) Insert(resource string, fields map[string]interface{}) (id string, err error) {
+	h.change(func() {
+		c, ok := h.resources[resource]
+		if !ok {
+			err = fmt.Errorf("unknown resource %s", resource)
+			return
+		}
+		if issues := c.issues(fields); len(issues) > 0 {
+			err = fmt.Errorf("invalid %s: %v", resource, issues)
+			return
+		}
+
+		id, _ = fields["_id"].(string)
+		if id == "" {
+			id = h.newID()
+		} else if c.items[id] != nil {
+			err = fmt.Errorf("%s %s already exists", resource, id)
+			return
+		}
+		c.insert(id, fields)
+		h.inserted(resource, id)
+	})
+
+	return id, err
+}
+
+// Patch updates an item as if it was done by another Ghost client, for
+// instance a deployment job
+func (h *Handler) Patch(resource string, id string, fields map[string]interface{}) (err error) {
+	h.change(func() {
+		c, ok := h.resources[resource]
+		if !ok || c.items[id] == nil {
+			err = fmt.Errorf("%s %s not found", resource, id)
+			return
+		}
+		c.update(id, fields, Username)
+	})
+
+	return err
+}
+
+// Run f while holding the lock, then call OnChange if any item was changed
+func (h *Handler) change(f func()) {
+	h.mu.Lock()
+	changes := h.changes()
+	f()
+	changed := h.changes() != changes
+	h.mu.Unlock()
+
+	if changed && h.options.OnChange != nil {
+		h.options.OnChange()
+	}
+}
+
+func (h *Handler) changes() int {
+	changes := 0
+	for _, c := range h.resources {
+		changes += c.changes
+	}
+	return changes
+}
+
+// Generate an ID, skipping the ones of inserted items
+func (h *Handler) newID() string {
+	for {
+		h.lastID++
+		id := fmt.Sprintf("%024x", h.lastID)
+
+		used := false
+		for _, c := range h.resources {
+			used = used || c.items[id] != nil
+		}
+		if !used {
+			return id
+		}
+	}
+}
+
+// Called once an item was inserted into a resource
+func (h *Handler) inserted(resource string, id string) {
+	if resource == "jobs" {
+		h.startJob(id)
+	}
+}
+
+// ServeHTTP serves the fake Ghost API
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.options.ErrorRate > 0 && rand.Float64() < h.options.ErrorRate {
+		writeError(w, http.StatusInternalServerError, "Simulated server error", nil)
+		return
+	}
+
+	h.change(func() {
+		h.serveHTTP(w, r)
+	})
+}
+
+// Accept either basic auth or a bearer token
+func authorized(r *http.Request) bool {
+	if username, password, ok := r.BasicAuth(); ok {
+		return username == Username && password == Password
+	}
+	return r.Header.Get("Authorization") == "Bearer "+Token
+}
+
+func (h *Handler) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r) {
+		writeError(w, http.StatusUnauthorized, "Please provide proper credentials", nil)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "version" && r.Method == "GET" {
+		h.version(w)
+		return
+	}
+
+	c, ok := h.resources[parts[0]]
+	if !ok || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, "The requested URL was not found on the server.", nil)
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case "GET":
+			c.list(w, r, parts[0])
+		case "POST":
+			id := h.newID()
+			if c.create(w, r, parts[0], id) {
+				h.inserted(parts[0], id)
+			}
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "The method is not allowed for the requested URL.", nil)
+		}
+		return
+	}
+
+	id := parts[1]
+	if c.items[id] == nil {
+		writeError(w, http.StatusNotFound, "The requested URL was not found on the server.", nil)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		c.get(w, r, parts[0], id)
+	case "PATCH", "DELETE":
+		etag := r.Header.Get("If-Match")
+		if etag == "" {
+			writeError(w, http.StatusPreconditionRequired,
+				"To edit a document its etag must be provided using the If-Match header", nil)
+			return
+		}
+		if etag != c.latest(id)["_etag"] {
+			writeError(w, http.StatusPreconditionFailed, "Client and server etags don't match", nil)
+			return
+		}
+		if r.Method == "PATCH" {
+			c.patch(w, r, parts[0], id)
+		} else {
+			c.delete(w, id)
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "The method is not allowed for the requested URL.", nil)
+	}
+}
+
+func (h *Handler) version(w http.ResponseWriter) {
+	version := h.options.Version
+	if version == "" {
+		version = Version
+	}
+	writeJSON(w, http.StatusOK, document{
+		"current_revision":      "0000000000000000000000000000000000000000",
+		"current_revision_date": "Thu, 01 Jan 1970 00:00:00 GMT",
+		"current_revision_name": version,
+	})
+}
+
+func (c *collection) latest(id string) document {
+	versions := c.items[id]
+	return versions[len(versions)-1]
+}
+
+func (c *collection) list(w http.ResponseWriter, r *http.Request, resource string) {
+	query := r.URL.Query()
+
+	where := map[string]interface{}{}
+	if v := query.Get("where"); v != "" {
+		if err := json.Unmarshal([]byte(v), &where); err != nil {
+			writeError(w, http.StatusBadRequest, "Unable to parse `where` clause", nil)
+			return
+		}
+	}
+	maxResults, err := queryInt(query.Get("max_results"), defaultMaxResults)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid max_results", nil)
+		return
+	}
+	page, err := queryInt(query.Get("page"), 1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid page", nil)
+		return
+	}
+
+	matching := []document{}
+	for _, id := range c.ids {
+		if item := c.latest(id); matches(item, where) {
+			matching = append(matching, c.item(resource, id, item))
+		}
+	}
+
+	items := []document{}
+	if start := (page - 1) * maxResults; start < len(matching) {
+		end := start + maxResults
+		if end > len(matching) {
+			end = len(matching)
+		}
+		items = matching[start:end]
+	}
+
+	links := map[string]interface{}{
+		"parent": map[string]string{"href": "/", "title": "home"},
+		"self":   map[string]string{"href": resource, "title": resource},
+	}
+	if page*maxResults < len(matching) {
+		links["next"] = map[string]string{
+			"href":  fmt.Sprintf("%s?max_results=%d&page=%d", resource, maxResults, page+1),
+			"title": "next page",
+		}
+	}
+
+	writeJSON(w, http.StatusOK, document{
+		"_items": items,
+		"_links": links,
+		"_meta": map[string]int{
+			"max_results": maxResults,
+			"page":        page,
+			"total":       len(matching),
+		},
+	})
+}
+
+// Insert an item from the request body, and return whether it succeeded
+func (c *collection) create(w http.ResponseWriter, r *http.Request, resource string, id string) bool {
+	fields, ok := decodeFields(w, r)
+	if !ok {
+		return false
+	}
+
+	if issues := c.issues(fields); len(issues) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, "Insertion failure: 1 document(s) contain(s) error(s)", issues)
+		return false
+	}
+	c.insert(id, fields)
+
+	writeJSON(w, http.StatusCreated, c.metadata(resource, id))
+	return true
+}
+
+func (c *collection) issues(fields map[string]interface{}) map[string]string {
+	issues := map[string]string{}
+	for _, field := range c.required {
+		if isEmpty(fields[field]) {
+			issues[field] = "required field"
+		}
+	}
+	if c.check != nil {
+		for field, issue := range c.check(fields) {
+			issues[field] = issue
+		}
+	}
+	return issues
+}
+
+func (c *collection) insert(id string, fields map[string]interface{}) {
+	now := time.Now().UTC().Format(http.TimeFormat)
+	item := document{"_id": id, "_created": now}
+	c.items[id] = []document{}
+	c.ids = append(c.ids, id)
+	c.save(id, item, fields, Username)
+}
+
+func (c *collection) get(w http.ResponseWriter, r *http.Request, resource string, id string) {
+	item := c.latest(id)
+
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || version < 1 || version > len(c.items[id]) {
+			writeError(w, http.StatusNotFound, "The requested URL was not found on the server.", nil)
+			return
+		}
+		item = c.items[id][version-1]
+	}
+
+	writeJSON(w, http.StatusOK, c.item(resource, id, item))
+}
+
+func (c *collection) patch(w http.ResponseWriter, r *http.Request, resource string, id string) {
+	fields, ok := decodeFields(w, r)
+	if !ok {
+		return
+	}
+
+	issues := map[string]string{}
+	for _, field := range c.required {
+		if value, ok := fields[field]; ok && isEmpty(value) {
+			issues[field] = "empty values not allowed"
+		}
+	}
+	if len(issues) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, "Update failure: 1 document(s) contain(s) error(s)", issues)
+		return
+	}
+
+	c.update(id, fields, Username)
+
+	writeJSON(w, http.StatusOK, c.metadata(resource, id))
+}
+
+func (c *collection) delete(w http.ResponseWriter, id string) {
+	delete(c.items, id)
+	for i, itemID := range c.ids {
+		if itemID == id {
+			c.ids = append(c.ids[:i], c.ids[i+1:]...)
+			break
+		}
+	}
+	c.changes++
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Add a new version of an item with the given top level fields replaced
+func (c *collection) update(id string, fields map[string]interface{}, user string) {
+	item := document{}
+	for k, v := range c.latest(id) {
+		item[k] = v
+	}
+	c.save(id, item, fields, user)
+}
+
+func (c *collection) save(id string, item document, fields map[string]interface{}, user string) {
+	for k, v := range fields {
+		if !strings.HasPrefix(k, "_") {
+			item[k] = v
+		}
+	}
+	item["user"] = user
+	item["_updated"] = time.Now().UTC().Format(http.TimeFormat)
+	item["_version"] = len(c.items[id]) + 1
+	delete(item, "_etag")
+	item["_etag"] = etag(item)
+
+	c.items[id] = append(c.items[id], item)
+	c.changes++
+}
+
+// Get an item along with its Eve metadata
+func (c *collection) item(resource string, id string, item document) document {
+	values := document{}
+	for k, v := range item {
+		values[k] = v
+	}
+	for k, v := range c.metadata(resource, id) {
+		if _, ok := values[k]; !ok {
+			values[k] = v
+		}
+	}
+
+	return values
+}
+
+func (c *collection) metadata(resource string, id string) document {
+	item := c.latest(id)
+
+	return document{
+		"_id":             id,
+		"_etag":           item["_etag"],
+		"_created":        item["_created"],
+		"_updated":        item["_updated"],
+		"_version":        item["_version"],
+		"_latest_version": len(c.items[id]),
+		"_links": map[string]interface{}{
+			"self": map[string]string{"href": resource + "/" + id, "title": c.title},
+		},
+		"_status": "OK",
+	}
+}
+
+func decodeFields(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	fields := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Unable to parse JSON body: %v", err), nil)
+		return nil, false
+	}
+
+	return fields, true
+}
+
+func matches(item document, where map[string]interface{}) bool {
+	for k, v := range where {
+		if !reflect.DeepEqual(item[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+func isEmpty(value interface{}) bool {
+	s, ok := value.(string)
+	return value == nil || ok && s == ""
+}
+
+func queryInt(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err == nil && i < 1 {
+		err = fmt.Errorf("%d is not a positive number", i)
+	}
+	return i, err
+}
+
+func etag(item document) string {
+	// Map keys are sorted when encoded
+	data, _ := json.Marshal(item)
+	sum := sha1.Sum(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func writeError(w http.ResponseWriter, code int, message string, issues map[string]string) {
+	body := document{
+		"_status": "ERR",
+		"_error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	}
+	if issues != nil {
+		body["_issues"] = issues
+	}
+
+	writeJSON(w, code, body)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
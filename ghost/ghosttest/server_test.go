@@ -0,0 +1,349 @@
+package ghosttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud-deploy.io/cloud-deploy-sdk-go"
+)
+
+func testClient(s *Server) *ghost.Client {
+	return ghost.NewClient(s.URL, Username, Password)
+}
+
+func testApp(name string) ghost.App {
+	return ghost.App{Name: name, Env: "dev", Role: "webfront"}
+}
+
+// Send a request to the fake Ghost API for the endpoints missing from the
+// SDK, decoding the JSON response into result, and return the status code
+func testRequest(t *testing.T, client *http.Client, method string, url string, body string,
+	headers map[string]string, result interface{}) int {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.SetBasicAuth(Username, Password)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error calling %s %s: %v", method, url, err)
+	}
+	defer res.Body.Close()
+
+	if result != nil {
+		json.NewDecoder(res.Body).Decode(result)
+	}
+	return res.StatusCode
+}
+
+func TestServerAppLifecycle(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := testClient(s)
+
+	metadata, err := client.CreateApp(testApp("wordpress"))
+	if err != nil {
+		t.Fatalf("Unexpected error creating app: %v", err)
+	}
+	if metadata.ID == "" || metadata.Etag == nil || *metadata.Version != 1 {
+		t.Fatalf("Unexpected metadata of created app: %#v", metadata)
+	}
+
+	app, err := client.GetApp(metadata.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error reading app: %v", err)
+	}
+	if app.Name != "wordpress" || app.User != Username || *app.Etag != *metadata.Etag ||
+		app.Links.Self.Href != "apps/"+metadata.ID {
+		t.Fatalf("Unexpected app: %#v", app)
+	}
+
+	app.Description = "Updated"
+	updated, err := client.UpdateApp(&app, metadata.ID, *metadata.Etag)
+	if err != nil {
+		t.Fatalf("Unexpected error updating app: %v", err)
+	}
+	if *updated.Version != 2 || *updated.LatestVersion != 2 || *updated.Etag == *metadata.Etag {
+		t.Fatalf("Unexpected metadata of updated app: %#v", updated)
+	}
+
+	// Etags must match the latest version
+	if _, err := client.UpdateApp(&app, metadata.ID, *metadata.Etag); err == nil ||
+		!strings.HasSuffix(err.Error(), "412") {
+		t.Fatalf("Expected 412 error updating app with an outdated etag, got %v", err)
+	}
+	if err := client.DeleteApp(metadata.ID, *metadata.Etag); err == nil ||
+		!strings.HasSuffix(err.Error(), "412") {
+		t.Fatalf("Expected 412 error deleting app with an outdated etag, got %v", err)
+	}
+
+	// Previous versions are kept
+	var previous ghost.App
+	if code := testRequest(t, http.DefaultClient, "GET", s.URL+"/apps/"+metadata.ID+"?version=1", "", nil,
+		&previous); code != http.StatusOK {
+		t.Fatalf("Unexpected response reading app version: %d", code)
+	}
+	if previous.Description != "" || *previous.Version != 1 || *previous.LatestVersion != 2 {
+		t.Fatalf("Unexpected app version: %#v", previous)
+	}
+
+	if err := client.DeleteApp(metadata.ID, *updated.Etag); err != nil {
+		t.Fatalf("Unexpected error deleting app: %v", err)
+	}
+	if _, err := client.GetApp(metadata.ID); err == nil || !strings.HasSuffix(err.Error(), "404") {
+		t.Fatalf("Expected 404 error reading deleted app, got %v", err)
+	}
+}
+
+func TestServerPatch(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := testClient(s)
+
+	metadata, _ := client.CreateApp(testApp("wordpress"))
+	if err := s.Patch("apps", metadata.ID, map[string]interface{}{"description": "Deployed"}); err != nil {
+		t.Fatalf("Unexpected error patching app: %v", err)
+	}
+
+	app, _ := client.GetApp(metadata.ID)
+	if app.Description != "Deployed" || app.Name != "wordpress" || *app.Etag == *metadata.Etag {
+		t.Fatalf("Unexpected patched app: %#v", app)
+	}
+
+	if code := testRequest(t, http.DefaultClient, "PATCH", s.URL+"/apps/"+metadata.ID, `{"role": "worker"}`,
+		map[string]string{"If-Match": *app.Etag}, nil); code != http.StatusOK {
+		t.Fatalf("Unexpected response patching app: %d", code)
+	}
+	app, _ = client.GetApp(metadata.ID)
+	if app.Role != "worker" || app.Description != "Deployed" || *app.Version != 3 {
+		t.Fatalf("Unexpected patched app: %#v", app)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	cases := []struct {
+		Method       string
+		Path         string
+		Body         string
+		Username     string
+		ExpectedCode int
+	}{
+		{"GET", "/apps", "", "invalid", http.StatusUnauthorized},
+		{"GET", "/unknown", "", Username, http.StatusNotFound},
+		{"GET", "/apps/123", "", Username, http.StatusNotFound},
+		{"POST", "/apps", `{"name": "wordpress"}`, Username, http.StatusUnprocessableEntity},
+		{"POST", "/apps", `{`, Username, http.StatusBadRequest},
+		{"GET", "/apps?where=" + url.QueryEscape("{"), "", Username, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.Method, s.URL+tc.Path, strings.NewReader(tc.Body))
+		req.SetBasicAuth(tc.Username, Password)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error calling %s %s: %v", tc.Method, tc.Path, err)
+		}
+
+		body := struct {
+			Status string            `json:"_status"`
+			Issues map[string]string `json:"_issues"`
+			Error  struct {
+				Code int `json:"code"`
+			} `json:"_error"`
+		}{}
+		json.NewDecoder(res.Body).Decode(&body)
+		res.Body.Close()
+
+		if res.StatusCode != tc.ExpectedCode || body.Status != "ERR" || body.Error.Code != tc.ExpectedCode {
+			t.Fatalf("Unexpected response to %s %s: %d %#v", tc.Method, tc.Path, res.StatusCode, body)
+		}
+		if tc.ExpectedCode == http.StatusUnprocessableEntity && body.Issues["env"] != "required field" {
+			t.Fatalf("Unexpected issues in response to %s %s: %#v", tc.Method, tc.Path, body.Issues)
+		}
+	}
+
+	// PATCH without If-Match
+	client := testClient(s)
+	metadata, _ := client.CreateApp(testApp("wordpress"))
+	if code := testRequest(t, http.DefaultClient, "PATCH", s.URL+"/apps/"+metadata.ID, `{}`, nil,
+		nil); code != http.StatusPreconditionRequired {
+		t.Fatalf("Expected 428 error patching app without etag, got %d", code)
+	}
+}
+
+func TestServerWhereAndPaging(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := testClient(s)
+
+	for _, name := range []string{"a", "b", "c"} {
+		client.CreateApp(testApp(name))
+	}
+	worker := testApp("d")
+	worker.Role = "worker"
+	client.CreateApp(worker)
+
+	cases := []struct {
+		Query         string
+		ExpectedNames []string
+		ExpectedTotal int
+		HasNext       bool
+	}{
+		{"", []string{"a", "b", "c", "d"}, 4, false},
+		{"?where=" + url.QueryEscape(`{"role": "webfront"}`), []string{"a", "b", "c"}, 3, false},
+		{"?max_results=2", []string{"a", "b"}, 4, true},
+		{"?max_results=2&page=2", []string{"c", "d"}, 4, false},
+		{"?max_results=2&page=3", []string{}, 4, false},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest("GET", s.URL+"/apps"+tc.Query, nil)
+		req.SetBasicAuth(Username, Password)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unexpected error listing apps: %v", err)
+		}
+
+		apps := struct {
+			ghost.Apps
+			Links struct {
+				Next *ghost.Link `json:"next"`
+			} `json:"_links"`
+		}{}
+		json.NewDecoder(res.Body).Decode(&apps)
+		res.Body.Close()
+
+		names := []string{}
+		for _, app := range apps.Items {
+			names = append(names, app.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tc.ExpectedNames, ",") ||
+			int(apps.Meta.Total) != tc.ExpectedTotal || (apps.Links.Next != nil) != tc.HasNext {
+			t.Fatalf("Unexpected apps listed with %q: %v (total %d)", tc.Query, names, apps.Meta.Total)
+		}
+	}
+}
+
+func testJob(t *testing.T, s *Server, appID string, modules string) map[string]interface{} {
+	body := `{"command": "deploy", "app_id": "` + appID + `", "modules": ` + modules + `}`
+	req, _ := http.NewRequest("POST", s.URL+"/jobs", strings.NewReader(body))
+	req.SetBasicAuth(Username, Password)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error creating job: %v", err)
+	}
+	defer res.Body.Close()
+
+	metadata := map[string]interface{}{}
+	json.NewDecoder(res.Body).Decode(&metadata)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Unexpected response creating job: %d %#v", res.StatusCode, metadata)
+	}
+
+	job, err := s.Get("jobs", metadata["_id"].(string))
+	if err != nil {
+		t.Fatalf("Unexpected error reading job: %v", err)
+	}
+	return job
+}
+
+func TestServerJobs(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := testClient(s)
+
+	app := testApp("wordpress")
+	app.Modules = &[]ghost.Module{{Name: "a"}, {Name: "b"}}
+	metadata, _ := client.CreateApp(app)
+
+	job := testJob(t, s, metadata.ID, `[{"name": "a", "rev": "master"}]`)
+	if job["status"] != JobDone || job["_version"] != 3 {
+		t.Fatalf("Unexpected deploy job: %#v", job)
+	}
+
+	deployed, _ := client.GetApp(metadata.ID)
+	modules := *deployed.Modules
+	if modules[0].Initialized == nil || !*modules[0].Initialized || modules[0].LastDeployment != job["_id"] ||
+		modules[1].Initialized != nil || deployed.PendingChanges == nil || len(*deployed.PendingChanges) != 0 {
+		t.Fatalf("Unexpected deployed app: %#v", deployed)
+	}
+
+	// Jobs only end after their duration, and may fail
+	s.Handler.options = Options{JobDuration: 10 * time.Millisecond, JobFailureRate: 1}
+	job = testJob(t, s, metadata.ID, `[]`)
+	if job["status"] != JobStarted {
+		t.Fatalf("Unexpected started job: %#v", job)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if job, _ = s.Get("jobs", job["_id"].(string)); job["status"] != JobFailed {
+		t.Fatalf("Unexpected failed job: %#v", job)
+	}
+	if app, _ := client.GetApp(metadata.ID); *app.Version != *deployed.Version {
+		t.Fatalf("Unexpected update of app by failed job: %#v", app)
+	}
+
+	if _, err := s.Insert("jobs", map[string]interface{}{"command": "deploy", "app_id": "unknown"}); err == nil ||
+		!strings.Contains(err.Error(), "must exist in resource 'apps'") {
+		t.Fatalf("Expected error inserting job of unknown app, got %v", err)
+	}
+}
+
+func TestServerErrorRate(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Handler.options.ErrorRate = 1
+
+	if _, err := testClient(s).GetApps(); err == nil || !strings.HasSuffix(err.Error(), "500") {
+		t.Fatalf("Expected 500 error listing apps, got %v", err)
+	}
+}
+
+func TestServerDumpAndLoad(t *testing.T) {
+	changes := 0
+	h := NewHandler(Options{OnChange: func() { changes++ }})
+
+	id, err := h.Insert("apps", map[string]interface{}{"_id": "5a5f2f2f2f2f2f2f2f2f2f2f", "name": "wordpress",
+		"env": "dev", "role": "webfront"})
+	if err != nil || id != "5a5f2f2f2f2f2f2f2f2f2f2f" {
+		t.Fatalf("Unexpected result inserting app: %s, %v", id, err)
+	}
+	if _, err := h.Insert("apps", map[string]interface{}{"_id": id, "name": "wordpress", "env": "dev",
+		"role": "webfront"}); err == nil {
+		t.Fatalf("Expected error inserting an existing app")
+	}
+	h.Patch("apps", id, map[string]interface{}{"description": "Updated"})
+	if changes != 2 {
+		t.Fatalf("Unexpected number of changes: %d", changes)
+	}
+
+	var buf bytes.Buffer
+	if err := h.Dump(&buf); err != nil {
+		t.Fatalf("Unexpected error dumping state: %v", err)
+	}
+
+	s := NewServer()
+	defer s.Close()
+	if err := s.Load(&buf); err != nil {
+		t.Fatalf("Unexpected error loading state: %v", err)
+	}
+
+	app, err := testClient(s).GetApp(id)
+	if err != nil || app.Description != "Updated" || *app.Version != 2 {
+		t.Fatalf("Unexpected loaded app: %#v, %v", app, err)
+	}
+	if code := testRequest(t, http.DefaultClient, "GET", s.URL+"/apps/"+id+"?version=1", "", nil,
+		nil); code != http.StatusOK {
+		t.Fatalf("Unexpected response reading loaded app version: %d", code)
+	}
+	if next, _ := s.Insert("apps", map[string]interface{}{"name": "a", "env": "dev", "role": "webfront"}); next == id {
+		t.Fatalf("Unexpected ID of new app after loading state: %s", next)
+	}
+}
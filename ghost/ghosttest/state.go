@@ -0,0 +1,62 @@
+package ghosttest
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type state struct {
+	LastID    int                        `json:"last_id"`
+	Resources map[string]collectionState `json:"resources"`
+}
+
+type collectionState struct {
+	IDs   []string              `json:"ids"`
+	Items map[string][]document `json:"items"`
+}
+
+// Dump writes all the versions of the stored items as JSON
+func (h *Handler) Dump(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := state{LastID: h.lastID, Resources: map[string]collectionState{}}
+	for resource, c := range h.resources {
+		s.Resources[resource] = collectionState{IDs: c.ids, Items: c.items}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// Load replaces the stored items by the ones written by Dump, and resumes the
+// jobs which were running
+func (h *Handler) Load(r io.Reader) error {
+	s := state{}
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID = s.LastID
+	for resource, c := range h.resources {
+		loaded := s.Resources[resource]
+		c.ids = append([]string{}, loaded.IDs...)
+		c.items = map[string][]document{}
+		for id, versions := range loaded.Items {
+			c.items[id] = versions
+		}
+	}
+
+	jobs := h.resources["jobs"]
+	for _, id := range jobs.ids {
+		if jobs.latest(id)["status"] == JobStarted {
+			h.scheduleJob(id)
+		}
+	}
+
+	return nil
+}
@@ -1,27 +1,193 @@
 package ghost
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"regexp"
+	"strings"
 )
 
+// Digests returned by HashSum
+var hashSumRegexp = regexp.MustCompile(`^hmac-sha256:[0-9a-f]{64}$`)
+
 func StrToB64(data string) string {
 	return base64.StdEncoding.EncodeToString([]byte(data))
 }
 
-func B64ToStr(data string) string {
-	str, _ := base64.StdEncoding.DecodeString(data)
+func B64ToStr(data string) (string, error) {
+	str, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 data: %v", err)
+	}
+
+	return string(str), nil
+}
+
+// HashSum returns the digest stored in state in place of values that must not
+// be kept in clear, an HMAC keyed by a salt so that short values can't be
+// looked up from the state
+func HashSum(salt string, data string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(data))
+
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// HashSumMatches checks whether hash is the digest of data returned by HashSum
+// with the given salt
+func HashSumMatches(salt string, hash string, data string) bool {
+	return hmac.Equal([]byte(hash), []byte(HashSum(salt, data)))
+}
+
+// IsHashSum checks whether data is a digest returned by HashSum
+func IsHashSum(data string) bool {
+	return hashSumRegexp.MatchString(data)
+}
 
-	return string(str)
+// NewHashSalt returns a random salt for HashSum
+func NewHashSalt() string {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(salt)
 }
 
 func MatchesRegexp(exp string) func(v interface{}, k string) (ws []string, errors []error) {
+	re := regexp.MustCompile(exp)
 	return func(v interface{}, k string) (ws []string, errors []error) {
 		value := v.(string)
-		if !regexp.MustCompile(exp).MatchString(value) {
+		if !re.MatchString(value) {
 			errors = append(errors, fmt.Errorf("%q must match %s", k, exp))
 		}
 		return
 	}
 }
+
+// ScriptPreview returns the first line of a script, truncated, to be shown in
+// place of scripts only stored as a hash in state
+func ScriptPreview(script string) string {
+	preview := strings.SplitN(script, "\n", 2)[0]
+	if len(preview) > 64 {
+		return preview[:64] + "..."
+	}
+	if len(preview) < len(script) {
+		return preview + "..."
+	}
+	return preview
+}
+
+// UnifiedDiff returns the lines that differ between old and new in unified
+// diff format, with 3 lines of context. It returns an empty string when there
+// is no difference.
+func UnifiedDiff(name, old, new string) string {
+	if old == new {
+		return ""
+	}
+
+	a, b := splitLines(old), splitLines(new)
+
+	// Longest common subsequence lengths of the lines suffixes
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type edit struct {
+		op   byte
+		line string
+		i, j int
+	}
+	edits := []edit{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", name, name)
+
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		first := start - context
+		if first < 0 {
+			first = 0
+		}
+		last := start
+		for k := start; k < len(edits) && k <= last+2*context; k++ {
+			if edits[k].op != ' ' {
+				last = k
+			}
+		}
+		end := last + context + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		oldCount, newCount := 0, 0
+		for _, e := range edits[first:end] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		oldStart, newStart := edits[first].i+1, edits[first].j+1
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, e := range edits[first:end] {
+			fmt.Fprintf(&out, "%c%s\n", e.op, e.line)
+		}
+
+		start = end
+	}
+
+	return out.String()
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
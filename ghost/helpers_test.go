@@ -2,6 +2,7 @@ package ghost
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -27,15 +28,19 @@ func TestB64ToStr(t *testing.T) {
 	cases := []struct {
 		Input          string
 		ExpectedOutput string
+		Valid          bool
 	}{
-		{"bXlzdHJpbmc=", "mystring"},
-		{"", ""},
-		{"-1", ""},
-		{"()", ""},
+		{"bXlzdHJpbmc=", "mystring", true},
+		{"", "", true},
+		{"-1", "", false},
+		{"()", "", false},
 	}
 
 	for _, tc := range cases {
-		output := B64ToStr(tc.Input)
+		output, err := B64ToStr(tc.Input)
+		if tc.Valid != (err == nil) {
+			t.Fatalf("Unexpected error from B64ToStr: %v", err)
+		}
 		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
 			t.Fatalf("Unexpected output from B64ToStr.\nExpected: %#v\nGiven:    %#v",
 				tc.ExpectedOutput, output)
@@ -60,3 +65,111 @@ func TestMatchesRegexp(t *testing.T) {
 		}
 	}
 }
+
+func TestHashSum(t *testing.T) {
+	cases := []struct {
+		Salt           string
+		Input          string
+		ExpectedOutput string
+	}{
+		{"salt", "mystring", "hmac-sha256:3d30dbe3bb313c9bed0883d35dd209e940601255aaf3c017b4083e39fb6128c4"},
+		{"salt", "", "hmac-sha256:379d7f7966f400cb6e3c0b2cca4bf8a2db03b8c81fef8020015b5a3103c30460"},
+		{"othersalt", "mystring", "hmac-sha256:bad37de2be6c98bae21329888ed74367c0754cc161da0cd2a4c453dc32be31d8"},
+	}
+
+	for _, tc := range cases {
+		output := HashSum(tc.Salt, tc.Input)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from HashSum.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestHashSumMatches(t *testing.T) {
+	cases := []struct {
+		Hash           string
+		Input          string
+		ExpectedOutput bool
+	}{
+		{HashSum("salt", "mystring"), "mystring", true},
+		{HashSum("salt", "mystring"), "otherstring", false},
+		{HashSum("othersalt", "mystring"), "mystring", false},
+		{"sha256:bd3ff47540b31e62d4ca6b07794e5a886b0f655fc322730f26ecd65cc7dd5c90", "mystring", false},
+		{"", "", false},
+	}
+
+	for _, tc := range cases {
+		output := HashSumMatches("salt", tc.Hash, tc.Input)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from HashSumMatches for %#v.\nExpected: %#v\nGiven:    %#v",
+				tc.Hash, tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestIsHashSum(t *testing.T) {
+	cases := []struct {
+		Input          string
+		ExpectedOutput bool
+	}{
+		{HashSum("salt", "mystring"), true},
+		{"sha256:bd3ff47540b31e62d4ca6b07794e5a886b0f655fc322730f26ecd65cc7dd5c90", false},
+		{"sha256:", false},
+		{"mystring", false},
+		{"", false},
+	}
+
+	for _, tc := range cases {
+		output := IsHashSum(tc.Input)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from IsHashSum.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestScriptPreview(t *testing.T) {
+	cases := []struct {
+		Input          string
+		ExpectedOutput string
+	}{
+		{"", ""},
+		{"echo ok", "echo ok"},
+		{"#!/bin/bash\necho ok\n", "#!/bin/bash..."},
+		{strings.Repeat("a", 70), strings.Repeat("a", 64) + "..."},
+	}
+
+	for _, tc := range cases {
+		output := ScriptPreview(tc.Input)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from ScriptPreview.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	cases := []struct {
+		Old            string
+		New            string
+		ExpectedOutput string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{"", "a\n", "--- script\n+++ script\n@@ -0,0 +1,1 @@\n+a\n"},
+		{"a\n", "", "--- script\n+++ script\n@@ -1,1 +0,0 @@\n-a\n"},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			"--- script\n+++ script\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+	}
+
+	for _, tc := range cases {
+		output := UnifiedDiff("script", tc.Old, tc.New)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from UnifiedDiff.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
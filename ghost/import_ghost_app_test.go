@@ -4,14 +4,20 @@ import (
 	"fmt"
 	"testing"
 
-	"github.com/hashicorp/terraform/helper/acctest"
+	"cloud-deploy.io/terraform-provider-cloud-deploy/ghost/ghosttest"
 	"github.com/hashicorp/terraform/helper/resource"
 )
 
 func TestAccGhostAppImportBasic(t *testing.T) {
-	envName := fmt.Sprintf("import_ghost_app_acc_env_basic_%s", acctest.RandString(10))
+	testAccRecordedTest(t, func(r *ghosttest.Recorder) resource.TestCase {
+		return testAccGhostAppImportBasicTestCase(t, r)
+	})
+}
+
+func testAccGhostAppImportBasicTestCase(t *testing.T, r *ghosttest.Recorder) resource.TestCase {
+	envName := fmt.Sprintf("import_ghost_app_acc_env_basic_%s", r.RandString(10))
 
-	resource.Test(t, resource.TestCase{
+	return resource.TestCase{
 		PreCheck:     func() { testAccPreCheck(t) },
 		CheckDestroy: testAccCheckGhostAppDestroy,
 		Providers:    testAccProviders,
@@ -24,6 +30,35 @@ func TestAccGhostAppImportBasic(t *testing.T) {
 				ResourceName:      "ghost_app.test",
 				ImportState:       true,
 				ImportStateVerify: true,
+				// The salt is generated again when importing
+				ImportStateVerifyIgnore: []string{"hash_salt"},
+			},
+		},
+	}
+}
+
+func TestGhostAppImportLifecycle(t *testing.T) {
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	config := testGhostAppFakeConfig(server, testAccGhostAppConfig("import_ghost_app_unit_env_basic"))
+
+	resource.UnitTest(t, resource.TestCase{
+		CheckDestroy: testAccCheckGhostAppDestroy,
+		Providers:    testAccProviders,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: config,
+			},
+
+			// The provider is configured from the step configuration
+			resource.TestStep{
+				Config:            config,
+				ResourceName:      "ghost_app.test",
+				ImportState:       true,
+				ImportStateVerify: true,
+				// The salt is generated again when importing
+				ImportStateVerifyIgnore: []string{"hash_salt"},
 			},
 		},
 	})
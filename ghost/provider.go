@@ -13,19 +13,102 @@ func Provider() terraform.ResourceProvider {
 		Schema: map[string]*schema.Schema{
 			"user": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("GHOST_USER", nil),
 			},
 			"password": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
+				Sensitive:   true,
 				DefaultFunc: schema.EnvDefaultFunc("GHOST_PASSWORD", nil),
 			},
+			// Bearer token authentication, instead of user and password
+			"token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("GHOST_TOKEN", nil),
+			},
+			"token_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GHOST_TOKEN_FILE", nil),
+			},
+			"token_command": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GHOST_TOKEN_COMMAND", nil),
+			},
 			"endpoint": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("GHOST_ENDPOINT", nil),
 			},
+			// Profile of the credentials file to use for the settings not set
+			// otherwise
+			"profile": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GHOST_PROFILE", nil),
+			},
+			"shared_credentials_file": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("GHOST_SHARED_CREDENTIALS_FILE", nil),
+			},
+			// Instance tags added to every app which doesn't set them
+			"default_instance_tags": {
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			// Values used for the ghost_app attributes left empty
+			"defaults": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"region": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"vpc_id": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: MatchesRegexp(`^vpc-[a-z0-9]*$`),
+						},
+						"log_notifications": {
+							Type: schema.TypeList,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: MatchesRegexp(`^[a-zA-Z0-9_.+-]+@[a-zA-Z0-9-]+\.[a-zA-Z0-9-.]+$`),
+							},
+							Optional: true,
+						},
+						"safe_deployment": {
+							Type:     schema.TypeList,
+							Optional: true,
+							MaxItems: 1,
+							Elem: &schema.Resource{
+								Schema: ghostAppSafeDeploymentSchema(),
+							},
+						},
+					},
+				},
+			},
+			// Send the whole app on updates, for Ghost versions which need it
+			"full_document_updates": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			// Don't call Ghost to check the endpoint and credentials
+			"skip_credentials_validation": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
@@ -41,8 +124,52 @@ func providerConfigure(data *schema.ResourceData) (interface{}, error) {
 		User:     data.Get("user").(string),
 		Password: data.Get("password").(string),
 		URL:      data.Get("endpoint").(string),
+
+		Token:        data.Get("token").(string),
+		TokenFile:    data.Get("token_file").(string),
+		TokenCommand: data.Get("token_command").(string),
+
+		Profile:         data.Get("profile").(string),
+		CredentialsFile: data.Get("shared_credentials_file").(string),
+
+		FullDocumentUpdates: data.Get("full_document_updates").(bool),
 	}
+	config.DefaultInstanceTags = map[string]string{}
+	for name, value := range data.Get("default_instance_tags").(map[string]interface{}) {
+		config.DefaultInstanceTags[name] = value.(string)
+	}
+	config.Defaults = expandGhostAppDefaults(data.Get("defaults").([]interface{}))
 	log.Println("[INFO] Initializing Ghost client")
 
-	return config.Client()
+	client, err := config.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	if !data.Get("skip_credentials_validation").(bool) {
+		if err := client.checkServer(); err != nil {
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+func expandGhostAppDefaults(d []interface{}) GhostAppDefaults {
+	defaults := GhostAppDefaults{}
+	if len(d) == 0 || d[0] == nil {
+		return defaults
+	}
+
+	data := d[0].(map[string]interface{})
+	defaults.Region = data["region"].(string)
+	defaults.VpcID = data["vpc_id"].(string)
+	if logNotifications := data["log_notifications"].([]interface{}); len(logNotifications) > 0 {
+		defaults.LogNotifications = expandGhostAppStringList(logNotifications)
+	}
+	if safeDeployment := data["safe_deployment"].([]interface{}); len(safeDeployment) > 0 {
+		defaults.SafeDeployment = expandGhostAppSafeDeployment(safeDeployment)
+	}
+
+	return defaults
 }
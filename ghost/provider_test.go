@@ -1,9 +1,14 @@
 package ghost
 
 import (
+	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"cloud-deploy.io/terraform-provider-cloud-deploy/ghost/ghosttest"
+	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 )
@@ -41,3 +46,64 @@ func testAccPreCheck(t *testing.T) {
 		t.Fatal("GHOST_ENDPOINT must be set for acceptance tests")
 	}
 }
+
+// Run an acceptance test case while recording its interactions with Ghost to
+// testdata/cassettes when TF_ACC_RECORD is set, or replay them from there so
+// that the test runs without a Ghost instance. Without a cassette to replay,
+// the test runs against the Ghost instance.
+func testAccRecordedTest(t *testing.T, testCase func(r *ghosttest.Recorder) resource.TestCase) {
+	path := filepath.Join("testdata", "cassettes", t.Name()+".json")
+	record := os.Getenv("TF_ACC_RECORD") != ""
+
+	var r *ghosttest.Recorder
+	if _, err := os.Stat(path); record || os.IsNotExist(err) {
+		r = ghosttest.NewRecorder(path, os.Getenv("GHOST_ENDPOINT"), os.Getenv("GHOST_USER"), os.Getenv("GHOST_PASSWORD"))
+	} else if r, err = ghosttest.LoadRecorder(path); err != nil {
+		t.Fatalf("Error loading cassette: %v", err)
+	}
+
+	c := testCase(r)
+	config := ""
+	for i, step := range c.Steps {
+		// Import steps configure the provider from the previous configuration
+		if step.Config == "" {
+			step.Config = config
+		} else if !r.Recording() {
+			step.Config = fmt.Sprintf(`
+      provider "ghost" {
+        user     = "%s"
+        password = "%s"
+        endpoint = "%s"
+
+        skip_credentials_validation = true
+      }
+	`, ghosttest.Username, ghosttest.Password, ghosttest.ReplayEndpoint) + step.Config
+		}
+		config = step.Config
+		c.Steps[i] = step
+	}
+	if !r.Recording() {
+		c.PreCheck = nil
+		c.IsUnitTest = true
+	}
+
+	configure := testAccProvider.ConfigureFunc
+	testAccProvider.ConfigureFunc = func(d *schema.ResourceData) (interface{}, error) {
+		meta, err := configure(d)
+		if err == nil {
+			meta.(*GhostClient).HTTPClient = &http.Client{Transport: r}
+		}
+		return meta, err
+	}
+	defer func() {
+		testAccProvider.ConfigureFunc = configure
+
+		if record && !t.Failed() {
+			if err := r.Save(); err != nil {
+				t.Fatalf("Error saving cassette: %v", err)
+			}
+		}
+	}()
+
+	resource.Test(t, c)
+}
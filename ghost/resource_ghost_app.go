@@ -1,13 +1,22 @@
 package ghost
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"cloud-deploy.io/cloud-deploy-sdk-go"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform/helper/hashcode"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
 )
@@ -19,6 +28,11 @@ func resourceGhostApp() *schema.Resource {
 		Update: resourceGhostAppUpdate,
 		Delete: resourceGhostAppDelete,
 
+		CustomizeDiff: resourceGhostAppCustomizeDiff,
+
+		SchemaVersion: 2,
+		MigrateState:  resourceGhostAppMigrateState,
+
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(1 * time.Minute),
 			Read:   schema.DefaultTimeout(1 * time.Minute),
@@ -27,7 +41,7 @@ func resourceGhostApp() *schema.Resource {
 		},
 
 		Importer: &schema.ResourceImporter{
-			State: schema.ImportStatePassthrough,
+			State: resourceGhostAppImportState,
 		},
 
 		Schema: map[string]*schema.Schema{
@@ -57,9 +71,10 @@ func resourceGhostApp() *schema.Resource {
 				Type:     schema.TypeString,
 				Optional: true,
 			},
+			// Required unless set in the provider defaults
 			"vpc_id": {
 				Type:         schema.TypeString,
-				Required:     true,
+				Optional:     true,
 				ValidateFunc: MatchesRegexp(`^vpc-[a-z0-9]*$`),
 			},
 			"instance_type": {
@@ -114,13 +129,21 @@ func resourceGhostApp() *schema.Resource {
 						},
 						"source_ami": {
 							Type:         schema.TypeString,
-							Required:     true,
+							Optional:     true,
 							ValidateFunc: MatchesRegexp(`^ami-[a-z0-9]*$`),
 						},
 						"ami_name": {
 							Type:     schema.TypeString,
 							Computed: true,
 						},
+						"source_container_image": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"container_image": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
 						"subnet_id": {
 							Type:         schema.TypeString,
 							Required:     true,
@@ -238,8 +261,9 @@ func resourceGhostApp() *schema.Resource {
 				},
 			},
 			"environment_variables": {
-				Type:     schema.TypeList,
-				Optional: true,
+				Type:          schema.TypeList,
+				Optional:      true,
+				ConflictsWith: []string{"environment_variables_map"},
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"key": {
@@ -254,6 +278,34 @@ func resourceGhostApp() *schema.Resource {
 					},
 				},
 			},
+			"environment_variables_map": {
+				Type:          schema.TypeMap,
+				Optional:      true,
+				ConflictsWith: []string{"environment_variables"},
+				ValidateFunc:  validateGhostAppEnvironmentVariablesMap,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"sensitive_environment_variables": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"key": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: MatchesRegexp(`^[a-zA-Z_]+[a-zA-Z0-9_]*$`),
+						},
+						"value": {
+							Type:             schema.TypeString,
+							Required:         true,
+							Sensitive:        true,
+							DiffSuppressFunc: suppressDiffHashedValue(),
+						},
+					},
+				},
+			},
 			"log_notifications": {
 				Type: schema.TypeList,
 				Elem: &schema.Schema{
@@ -330,6 +382,30 @@ func resourceGhostApp() *schema.Resource {
 							ValidateFunc:     validation.ValidateJsonString,
 							DiffSuppressFunc: suppressDiffFeaturesParameters(),
 						},
+						"parameter": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"name": {
+										Type:     schema.TypeString,
+										Required: true,
+									},
+									"value": {
+										Type:             schema.TypeString,
+										Required:         true,
+										DiffSuppressFunc: suppressDiffFeatureParameterValue(),
+									},
+									"type": {
+										Type:     schema.TypeString,
+										Optional: true,
+										Default:  "string",
+										ValidateFunc: validation.StringInSlice([]string{
+											"string", "number", "bool", "json"}, false),
+									},
+								},
+							},
+						},
 					},
 				},
 			},
@@ -356,66 +432,29 @@ func resourceGhostApp() *schema.Resource {
 							Type:     schema.TypeString,
 							Optional: true,
 						},
+						"pre_buildimage_file":  resourceGhostAppScriptFileSchema(),
+						"post_buildimage_file": resourceGhostAppScriptFileSchema(),
+						"pre_bootstrap_file":   resourceGhostAppScriptFileSchema(),
+						"post_bootstrap_file":  resourceGhostAppScriptFileSchema(),
+						"file_previews":        resourceGhostAppFilePreviewsSchema(),
 					},
 				},
 			},
 			"modules": {
-				Type:     schema.TypeList,
-				Required: true,
+				Type:          schema.TypeList,
+				Optional:      true,
+				ConflictsWith: []string{"keyed_modules"},
 				Elem: &schema.Resource{
-					Schema: map[string]*schema.Schema{
-						"name": {
-							Type:         schema.TypeString,
-							Required:     true,
-							ValidateFunc: MatchesRegexp(`^[a-zA-Z0-9\.\-\_]*$`),
-						},
-						"git_repo": {
-							Type:     schema.TypeString,
-							Required: true,
-						},
-						"path": {
-							Type:         schema.TypeString,
-							Required:     true,
-							ValidateFunc: MatchesRegexp(`^(/[a-zA-Z0-9\.\-\_]+)+$`),
-						},
-						"scope": {
-							Type:         schema.TypeString,
-							Required:     true,
-							ValidateFunc: validation.StringInSlice([]string{"system", "code"}, false),
-						},
-						"uid": {
-							Type:         schema.TypeInt,
-							Optional:     true,
-							Default:      0,
-							ValidateFunc: validation.IntAtLeast(0),
-						},
-						"gid": {
-							Type:         schema.TypeInt,
-							Optional:     true,
-							Default:      0,
-							ValidateFunc: validation.IntAtLeast(0),
-						},
-						"build_pack": {
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"pre_deploy": {
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"post_deploy": {
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"after_all_deploy": {
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"last_deployment": {
-							Type:     schema.TypeString,
-							Computed: true,
-						},
-					},
+					Schema: resourceGhostAppModuleSchema(),
+				},
+			},
+			"keyed_modules": {
+				Type:          schema.TypeSet,
+				Optional:      true,
+				ConflictsWith: []string{"modules"},
+				Set:           hashGhostAppKeyedModule,
+				Elem: &schema.Resource{
+					Schema: resourceGhostAppKeyedModuleSchema(),
 				},
 			},
 			"safe_deployment": {
@@ -423,55 +462,279 @@ func resourceGhostApp() *schema.Resource {
 				Optional:         true,
 				MaxItems:         1,
 				DiffSuppressFunc: suppressDiffSafeDeployment(),
+				Elem: &schema.Resource{
+					Schema: ghostAppSafeDeploymentSchema(),
+				},
+			},
+			"etag": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"created_at": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"updated_at": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"version": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"last_modified_by": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"api_url": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"undeployed_modules": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"pending_changes": {
+				Type:     schema.TypeList,
+				Computed: true,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
-						"ha_backend": {
+						"field": {
 							Type:     schema.TypeString,
-							Optional: true,
+							Computed: true,
 						},
-						"load_balancer_type": {
+						"updated": {
 							Type:     schema.TypeString,
-							Optional: true,
-							ValidateFunc: validation.StringInSlice([]string{
-								"elb", "alb", "haproxy"}, false),
-							Default: "elb",
+							Computed: true,
 						},
-						"app_tag_value": {
+						"user": {
 							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"api_port": {
-							Type:     schema.TypeInt,
-							Optional: true,
-						},
-						"wait_before_deploy": {
-							Type:         schema.TypeInt,
-							Optional:     true,
-							ValidateFunc: validation.IntAtLeast(0),
-							Default:      10,
-						},
-						"wait_after_deploy": {
-							Type:         schema.TypeInt,
-							Optional:     true,
-							ValidateFunc: validation.IntAtLeast(0),
-							Default:      10,
+							Computed: true,
 						},
 					},
 				},
 			},
-			"etag": {
+			"fail_on_pending_changes": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"etag_conflict_strategy": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "fail",
+				ValidateFunc: validation.StringInSlice([]string{"fail", "refresh_and_retry"}, false),
+			},
+			"render_templates": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"scripts_diff": {
 				Type:     schema.TypeString,
 				Computed: true,
 			},
+			// Salt of the hashes stored in place of sensitive values
+			"hash_salt": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			// Values sent to Ghost, including the provider defaults
+			"effective_region": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"effective_vpc_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"effective_log_notifications": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"effective_safe_deployment": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: computedGhostAppSchema(ghostAppSafeDeploymentSchema()),
+				},
+			},
+			// Instance tags sent to Ghost, including the provider default ones
+			"instance_tags_all": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// Schema of a module, shared by the modules list and the keyed_modules set
+func resourceGhostAppModuleSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"name": {
+			Type:         schema.TypeString,
+			Required:     true,
+			ValidateFunc: MatchesRegexp(`^[a-zA-Z0-9\.\-\_]*$`),
+		},
+		"git_repo": {
+			Type:     schema.TypeString,
+			Required: true,
+		},
+		"path": {
+			Type:         schema.TypeString,
+			Required:     true,
+			ValidateFunc: MatchesRegexp(`^(/[a-zA-Z0-9\.\-\_]+)+$`),
+		},
+		"scope": {
+			Type:         schema.TypeString,
+			Required:     true,
+			ValidateFunc: validation.StringInSlice([]string{"system", "code"}, false),
+		},
+		"uid": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			Default:      0,
+			ValidateFunc: validation.IntAtLeast(0),
+		},
+		"gid": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			Default:      0,
+			ValidateFunc: validation.IntAtLeast(0),
+		},
+		"build_pack": {
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"pre_deploy": {
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"post_deploy": {
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"after_all_deploy": {
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"build_pack_file":       resourceGhostAppScriptFileSchema(),
+		"pre_deploy_file":       resourceGhostAppScriptFileSchema(),
+		"post_deploy_file":      resourceGhostAppScriptFileSchema(),
+		"after_all_deploy_file": resourceGhostAppScriptFileSchema(),
+		"file_previews":         resourceGhostAppFilePreviewsSchema(),
+		"last_deployment": {
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"initialized": {
+			Type:     schema.TypeBool,
+			Computed: true,
+		},
+		"needs_initial_deploy": {
+			Type:     schema.TypeBool,
+			Computed: true,
+		},
+	}
+}
+
+// Modules in keyed_modules are identified by name, deployment order being
+// given by the order attribute
+func resourceGhostAppKeyedModuleSchema() map[string]*schema.Schema {
+	moduleSchema := resourceGhostAppModuleSchema()
+	moduleSchema["order"] = &schema.Schema{
+		Type:     schema.TypeInt,
+		Required: true,
+	}
+
+	return moduleSchema
+}
+
+// Scripts can be read from a file, in which case only a hash of the script
+// is stored in state
+func resourceGhostAppScriptFileSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:             schema.TypeString,
+		Optional:         true,
+		DiffSuppressFunc: suppressDiffScriptFile(),
+	}
+}
+
+func resourceGhostAppFilePreviewsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeMap,
+		Computed: true,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	}
+}
+
+func ghostAppSafeDeploymentSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"ha_backend": {
+			Type:     schema.TypeString,
+			Optional: true,
 		},
+		"load_balancer_type": {
+			Type:     schema.TypeString,
+			Optional: true,
+			ValidateFunc: validation.StringInSlice([]string{
+				"elb", "alb", "haproxy"}, false),
+			Default: "elb",
+		},
+		"app_tag_value": {
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"api_port": {
+			Type:     schema.TypeInt,
+			Optional: true,
+		},
+		"wait_before_deploy": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: validation.IntAtLeast(0),
+			Default:      10,
+		},
+		"wait_after_deploy": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: validation.IntAtLeast(0),
+			Default:      10,
+		},
+	}
+}
+
+// Get computed attributes matching the given ones
+func computedGhostAppSchema(attributes map[string]*schema.Schema) map[string]*schema.Schema {
+	computed := map[string]*schema.Schema{}
+	for k, s := range attributes {
+		computed[k] = &schema.Schema{Type: s.Type, Computed: true}
 	}
+	return computed
+}
+
+// Keyed modules are hashed by name and order, not by name alone, so that
+// modules sharing a name are kept in the set and reported by CustomizeDiff
+func hashGhostAppKeyedModule(v interface{}) int {
+	module := v.(map[string]interface{})
+	return hashcode.String(fmt.Sprintf("%s-%d", module["name"].(string), module["order"].(int)))
 }
 
 func resourceGhostAppCreate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*ghost.Client)
+	client := meta.(*GhostClient)
 
 	log.Printf("[INFO] Creating Ghost app %s", d.Get("name").(string))
-	app := expandGhostApp(d)
+	app, err := expandGhostApp(d, client)
+	if err != nil {
+		return fmt.Errorf("[ERROR] error creating Ghost app: %v", err)
+	}
+	omitUnsupportedGhostAppFields(d, &app, client)
 
 	eveMetadata, err := client.CreateApp(app)
 	if err != nil {
@@ -484,15 +747,24 @@ func resourceGhostAppCreate(d *schema.ResourceData, meta interface{}) error {
 	return resourceGhostAppRead(d, meta)
 }
 
+// Attributes which are not stored in Ghost get their default value on import
+func resourceGhostAppImportState(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	d.Set("render_templates", false)
+	d.Set("fail_on_pending_changes", false)
+	d.Set("etag_conflict_strategy", "fail")
+
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourceGhostAppRead(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*ghost.Client)
+	client := meta.(*GhostClient)
 
 	log.Printf("[INFO] Reading Ghost app %s", d.Get("name").(string))
 
 	app, err := client.GetApp(d.Id())
 	if err != nil {
 		// If app was not found, return nil to show that app is gone
-		if err.Error()[len(err.Error())-3:] == "404" {
+		if isGhostAPIStatus(err, http.StatusNotFound) {
 			d.SetId("")
 			log.Printf("[WARN] Ghost app (%s) not found, removing from state", d.Id())
 			return nil
@@ -500,24 +772,92 @@ func resourceGhostAppRead(d *schema.ResourceData, meta interface{}) error {
 		return fmt.Errorf("[ERROR] error reading Ghost app: %v", err)
 	}
 
-	if err := flattenGhostApp(d, app); err != nil {
+	effective := app
+	flattenGhostAppProviderDefaults(d, &app, client)
+	if err := flattenGhostApp(d, app, effective); err != nil {
 		return fmt.Errorf("[ERROR] error reading Ghost app: %v", err)
 	}
+	d.Set("api_url", ghostAppAPIURL(client.Endpoint, app))
+
+	if app.PendingChanges != nil && len(*app.PendingChanges) > 0 {
+		log.Printf("[WARN] Ghost app (%s) has pending changes, a buildimage or deployment is needed: %s",
+			d.Id(), ghostAppPendingChangesFields(*app.PendingChanges))
+	}
 
 	return nil
 }
 
 func resourceGhostAppUpdate(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*ghost.Client)
+	client := meta.(*GhostClient)
 
 	log.Printf("[INFO] Updating Ghost app %s", d.Get("name").(string))
 
-	app_updated := expandGhostApp(d)
+	app_updated, err := expandGhostApp(d, client)
+	if err != nil {
+		return fmt.Errorf("[ERROR] error updating Ghost app: %v", err)
+	}
+	omitUnsupportedGhostAppFields(d, &app_updated, client)
+
+	fields := ghostAppChangedFields(d)
+	if !client.FullDocumentUpdates {
+		if len(fields) == 0 {
+			return resourceGhostAppRead(d, meta)
+		}
+		// Hashed values of fields which are not sent don't need to be resolved
+		if !ghostAppHasField(fields, "env_vars") {
+			app_updated.EnvironmentVariables = &[]ghost.EnvironmentVariable{}
+		}
+		if !ghostAppHasField(fields, "modules") {
+			app_updated.Modules = &[]ghost.Module{}
+		}
+		if !ghostAppHasField(fields, "lifecycle_hooks") {
+			app_updated.LifecycleHooks = &ghost.LifecycleHooks{}
+		}
+	}
+
+	// Values that didn't change are only known by their hash in state
+	sensitiveKeys := ghostAppEnvironmentVariablesKeys(d.Get("sensitive_environment_variables").([]interface{}))
+	if ghostAppHasHashedValues(app_updated, sensitiveKeys) {
+		app, err := client.GetApp(d.Id())
+		if err != nil {
+			return fmt.Errorf("[ERROR] error reading Ghost app: %v", err)
+		}
+		if err := resolveGhostAppHashedValues(&app_updated, app, sensitiveKeys,
+			d.Get("hash_salt").(string)); err != nil {
+			return fmt.Errorf("[ERROR] error updating Ghost app: %v", err)
+		}
+	}
+
+	var patch map[string]interface{}
+	if !client.FullDocumentUpdates {
+		log.Printf("[DEBUG] Updating Ghost app fields: %s", strings.Join(fields, ", "))
+		if patch, err = ghostAppPatch(app_updated, fields); err != nil {
+			return fmt.Errorf("[ERROR] error updating Ghost app: %v", err)
+		}
+	} else if fields, err = ghostAppDocumentFields(app_updated); err != nil {
+		return fmt.Errorf("[ERROR] error updating Ghost app: %v", err)
+	}
+
+	var eveMetadata ghost.EveItemMetadata
+	etag := d.Get("etag").(string)
+	for attempt := 1; ; attempt++ {
+		if client.FullDocumentUpdates {
+			eveMetadata, err = client.UpdateApp(&app_updated, d.Id(), etag)
+		} else {
+			eveMetadata, err = client.PatchApp(patch, d.Id(), etag)
+		}
+		if !isGhostAppEtagConflict(err) || d.Get("etag_conflict_strategy").(string) != "refresh_and_retry" ||
+			attempt == ghostAppEtagConflictAttempts {
+			break
+		}
 
-	eveMetadata, err := client.UpdateApp(&app_updated, d.Id(), d.Get("etag").(string))
+		log.Printf("[WARN] Ghost app (%s) has been updated since last refresh, retrying", d.Id())
+		if etag, err = ghostAppConflictFreeEtag(client, d, fields); err != nil {
+			return fmt.Errorf("[ERROR] error updating Ghost app: %v", err)
+		}
+	}
 	if err != nil {
-		ec := err.Error()[len(err.Error())-3:]
-		if ec == "412" {
+		if isGhostAppEtagConflict(err) {
 			return fmt.Errorf(`[ERROR] error updating Ghost app: app has been updated since
 				last plan, you should run plan again: %v`, err)
 		}
@@ -530,14 +870,23 @@ func resourceGhostAppUpdate(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceGhostAppDelete(d *schema.ResourceData, meta interface{}) error {
-	client := meta.(*ghost.Client)
+	client := meta.(*GhostClient)
 
 	log.Printf("[INFO] Deleting Ghost app %s", d.Get("name").(string))
 
 	err := client.DeleteApp(d.Id(), d.Get("etag").(string))
+	if isGhostAppEtagConflict(err) && d.Get("etag_conflict_strategy").(string) == "refresh_and_retry" {
+		log.Printf("[WARN] Ghost app (%s) has been updated since last refresh, retrying", d.Id())
+
+		// The whole app is deleted, so any change in Ghost is a conflict
+		var etag string
+		if etag, err = ghostAppConflictFreeEtag(client, d, nil); err != nil {
+			return fmt.Errorf("[ERROR] error deleting Ghost app: %v", err)
+		}
+		err = client.DeleteApp(d.Id(), etag)
+	}
 	if err != nil {
-		ec := err.Error()[len(err.Error())-3:]
-		if ec == "412" {
+		if isGhostAppEtagConflict(err) {
 			return fmt.Errorf(`[ERROR] error deleting Ghost app: app has been updated since
 					last destroy plan, you should run destroy plan again: %v`, err)
 		}
@@ -549,8 +898,34 @@ func resourceGhostAppDelete(d *schema.ResourceData, meta interface{}) error {
 	return nil
 }
 
-// Get app from TF configuration
-func expandGhostApp(d *schema.ResourceData) ghost.App {
+// Configuration getter implemented by both schema.ResourceData and
+// schema.ResourceDiff, so that an app can be expanded at plan time
+type ghostAppResourceConfig interface {
+	Get(key string) interface{}
+	GetOk(key string) (interface{}, bool)
+}
+
+// Get app from TF configuration, with the provider defaults of the client
+// unless it's nil
+func expandGhostApp(d ghostAppResourceConfig, client *GhostClient) (ghost.App, error) {
+	features, err := expandGhostAppFeatures(d.Get("features").([]interface{}))
+	if err != nil {
+		return ghost.App{}, err
+	}
+	modules, err := expandGhostAppModules(d.Get("modules").([]interface{}))
+	if err != nil {
+		return ghost.App{}, err
+	}
+	if v, ok := d.GetOk("keyed_modules"); ok {
+		if modules, err = expandGhostAppKeyedModules(v.(*schema.Set).List()); err != nil {
+			return ghost.App{}, err
+		}
+	}
+	lifecycleHooks, err := expandGhostAppLifecycleHooks(d.Get("lifecycle_hooks").([]interface{}))
+	if err != nil {
+		return ghost.App{}, err
+	}
+
 	app := ghost.App{
 		Name:               d.Get("name").(string),
 		Env:                d.Get("env").(string),
@@ -561,23 +936,376 @@ func expandGhostApp(d *schema.ResourceData) ghost.App {
 		VpcID:              d.Get("vpc_id").(string),
 		InstanceMonitoring: d.Get("instance_monitoring").(bool),
 
-		Modules:              expandGhostAppModules(d.Get("modules").([]interface{})),
-		Features:             expandGhostAppFeatures(d.Get("features").([]interface{})),
+		Modules:              modules,
+		Features:             features,
 		Autoscale:            expandGhostAppAutoscale(d.Get("autoscale").([]interface{})),
 		BuildInfos:           expandGhostAppBuildInfos(d.Get("build_infos").([]interface{})),
 		EnvironmentInfos:     expandGhostAppEnvironmentInfos(d.Get("environment_infos").([]interface{})),
-		LifecycleHooks:       expandGhostAppLifecycleHooks(d.Get("lifecycle_hooks").([]interface{})),
+		LifecycleHooks:       lifecycleHooks,
 		LogNotifications:     expandGhostAppStringList(d.Get("log_notifications").([]interface{})),
 		EnvironmentVariables: expandGhostAppEnvironmentVariables(d.Get("environment_variables").([]interface{})),
 		SafeDeployment:       expandGhostAppSafeDeployment(d.Get("safe_deployment").([]interface{})),
 	}
 
-	return app
+	if v, ok := d.GetOk("environment_variables_map"); ok {
+		app.EnvironmentVariables = expandGhostAppEnvironmentVariablesMap(v.(map[string]interface{}))
+	}
+
+	// Templates are rendered with the values sent to Ghost, defaults included
+	if client != nil {
+		expandGhostAppProviderDefaults(d, &app, client)
+	}
+
+	// Sensitive environment variables are not available to templates
+	if d.Get("render_templates").(bool) {
+		if err := renderGhostAppScripts(&app); err != nil {
+			return ghost.App{}, err
+		}
+	}
+
+	// Ghost stores sensitive and regular environment variables in the same list
+	sensitiveEnvironmentVariables := expandGhostAppEnvironmentVariables(
+		d.Get("sensitive_environment_variables").([]interface{}))
+	*app.EnvironmentVariables = append(*app.EnvironmentVariables, *sensitiveEnvironmentVariables...)
+
+	return app, nil
 }
 
-func flattenGhostApp(d *schema.ResourceData, app ghost.App) error {
-	d.Set("name", app.Name)
-	d.Set("env", app.Env)
+// Add the provider defaults to an app, for the attributes it leaves empty
+func expandGhostAppProviderDefaults(d ghostAppResourceConfig, app *ghost.App, client *GhostClient) {
+	effective := effectiveGhostAppDefaults(d, client.Defaults)
+	app.Region = effective.Region
+	app.VpcID = effective.VpcID
+	if effective.LogNotifications != nil {
+		app.LogNotifications = effective.LogNotifications
+	}
+	if effective.SafeDeployment != nil {
+		app.SafeDeployment = effective.SafeDeployment
+	}
+	if app.EnvironmentInfos != nil {
+		app.EnvironmentInfos.InstanceTags = mergeGhostAppInstanceTags(
+			app.EnvironmentInfos.InstanceTags, client.DefaultInstanceTags)
+	}
+}
+
+// Get the values of the attributes which can have a provider default, either
+// set by the app or by the defaults, nil or empty if set by none
+func effectiveGhostAppDefaults(d ghostAppResourceConfig, defaults GhostAppDefaults) GhostAppDefaults {
+	effective := defaults
+	if v := d.Get("region").(string); v != "" {
+		effective.Region = v
+	}
+	if v := d.Get("vpc_id").(string); v != "" {
+		effective.VpcID = v
+	}
+	if v := d.Get("log_notifications").([]interface{}); len(v) > 0 {
+		effective.LogNotifications = expandGhostAppStringList(v)
+	}
+	if v := d.Get("safe_deployment").([]interface{}); len(v) > 0 {
+		effective.SafeDeployment = expandGhostAppSafeDeployment(v)
+	}
+	return effective
+}
+
+// Client giving the effective values in state as provider defaults, so that
+// an app expands as last applied when the provider configuration isn't
+// available
+func ghostAppStateDefaultsClient(d ghostAppResourceConfig) *GhostClient {
+	defaults := GhostAppDefaults{
+		Region: d.Get("effective_region").(string),
+		VpcID:  d.Get("effective_vpc_id").(string),
+	}
+	if v := d.Get("effective_log_notifications").([]interface{}); len(v) > 0 {
+		defaults.LogNotifications = expandGhostAppStringList(v)
+	}
+	if v := d.Get("effective_safe_deployment").([]interface{}); len(v) > 0 {
+		defaults.SafeDeployment = expandGhostAppSafeDeployment(v)
+	}
+
+	instanceTags := map[string]string{}
+	for k, v := range d.Get("instance_tags_all").(map[string]interface{}) {
+		instanceTags[k] = v.(string)
+	}
+
+	return &GhostClient{Defaults: defaults, DefaultInstanceTags: instanceTags}
+}
+
+// Remove the provider defaults from an app read from Ghost, unless configured,
+// so that they don't show as changes, and set the attributes showing them
+func flattenGhostAppProviderDefaults(d *schema.ResourceData, app *ghost.App, client *GhostClient) {
+	defaults := client.Defaults
+
+	d.Set("effective_region", app.Region)
+	d.Set("effective_vpc_id", app.VpcID)
+	d.Set("effective_log_notifications", flattenGhostAppStringList(app.LogNotifications))
+	d.Set("effective_safe_deployment", flattenGhostAppSafeDeployment(app.SafeDeployment))
+
+	if defaults.Region != "" && app.Region == defaults.Region && d.Get("region").(string) == "" {
+		app.Region = ""
+	}
+	if defaults.VpcID != "" && app.VpcID == defaults.VpcID && d.Get("vpc_id").(string) == "" {
+		app.VpcID = ""
+	}
+	if defaults.LogNotifications != nil && reflect.DeepEqual(app.LogNotifications, defaults.LogNotifications) &&
+		len(d.Get("log_notifications").([]interface{})) == 0 {
+		app.LogNotifications = []string{}
+	}
+	if defaults.SafeDeployment != nil && app.SafeDeployment != nil &&
+		reflect.DeepEqual(*app.SafeDeployment, *defaults.SafeDeployment) &&
+		len(d.Get("safe_deployment").([]interface{})) == 0 {
+		app.SafeDeployment = nil
+	}
+
+	// The environment infos are copied so that the app read from Ghost is kept
+	if app.EnvironmentInfos != nil {
+		d.Set("instance_tags_all", flattenGhostAppInstanceTagsMap(app.EnvironmentInfos.InstanceTags))
+		environmentInfos := *app.EnvironmentInfos
+		environmentInfos.InstanceTags = subtractGhostAppInstanceTags(environmentInfos.InstanceTags,
+			client.DefaultInstanceTags, d.Get("environment_infos.0.instance_tags").([]interface{}))
+		app.EnvironmentInfos = &environmentInfos
+	}
+}
+
+// Ghost app fields updated by each attribute, attributes which are not sent to
+// Ghost have no field
+var ghostAppAttributesFields = map[string][]string{
+	"name":                            {"name"},
+	"env":                             {"env"},
+	"role":                            {"role"},
+	"description":                     {"description"},
+	"region":                          {"region"},
+	"instance_type":                   {"instance_type"},
+	"vpc_id":                          {"vpc_id"},
+	"instance_monitoring":             {"instance_monitoring"},
+	"modules":                         {"modules"},
+	"keyed_modules":                   {"modules"},
+	"features":                        {"features"},
+	"autoscale":                       {"autoscale"},
+	"build_infos":                     {"build_infos"},
+	"environment_infos":               {"environment_infos"},
+	"lifecycle_hooks":                 {"lifecycle_hooks"},
+	"log_notifications":               {"log_notifications"},
+	"environment_variables":           {"env_vars"},
+	"environment_variables_map":       {"env_vars"},
+	"sensitive_environment_variables": {"env_vars"},
+	"safe_deployment":                 {"safe-deployment"},
+	"render_templates":                {"modules", "lifecycle_hooks"},
+	"blue_green":                      nil,
+	"fail_on_pending_changes":         nil,
+	"etag_conflict_strategy":          nil,
+	"effective_region":                {"region"},
+	"effective_vpc_id":                {"vpc_id"},
+	"effective_log_notifications":     {"log_notifications"},
+	"effective_safe_deployment":       {"safe-deployment"},
+	"instance_tags_all":               {"environment_infos"},
+}
+
+// Get the sorted Ghost app fields of the attributes which changed
+func ghostAppChangedFields(d *schema.ResourceData) []string {
+	changed := map[string]bool{}
+	for attribute, fields := range ghostAppAttributesFields {
+		if d.HasChange(attribute) {
+			for _, field := range fields {
+				changed[field] = true
+			}
+		}
+	}
+
+	// Templates are given the whole app, so scripts are rendered again and sent
+	// whenever another field changes
+	if d.Get("render_templates").(bool) && len(changed) > 0 {
+		changed["modules"], changed["lifecycle_hooks"] = true, true
+	}
+
+	fields := []string{}
+	for field := range changed {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+func ghostAppHasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Number of updates tried when the app keeps changing in Ghost
+const ghostAppEtagConflictAttempts = 3
+
+func isGhostAppEtagConflict(err error) bool {
+	return isGhostAPIStatus(err, http.StatusPreconditionFailed)
+}
+
+// Get the etag of the app in Ghost once checked that none of the given fields
+// changed in Ghost since the last refresh. Without fields, any change is a
+// conflict.
+func ghostAppConflictFreeEtag(client *GhostClient, d *schema.ResourceData, fields []string) (string, error) {
+	base, err := client.GetAppVersion(d.Id(), int64(d.Get("version").(int)))
+	if err != nil {
+		return "", fmt.Errorf("error reading Ghost app version %d: %v", d.Get("version").(int), err)
+	}
+	latest, err := client.GetApp(d.Id())
+	if err != nil {
+		return "", fmt.Errorf("error reading Ghost app: %v", err)
+	}
+
+	changed, err := ghostAppChangedDocumentFields(base, latest)
+	if err != nil {
+		return "", err
+	}
+
+	conflicts := []string{}
+	for _, field := range changed {
+		if fields == nil || ghostAppHasField(fields, field) {
+			conflicts = append(conflicts, field)
+		}
+	}
+	if len(conflicts) > 0 {
+		return "", fmt.Errorf("app has been updated since last refresh, fields changed both in Ghost "+
+			"and in configuration: %s, you should run plan again", strings.Join(conflicts, ", "))
+	}
+
+	return *latest.Etag, nil
+}
+
+// Get the fields of the app document, without the ones managed by Ghost
+func ghostAppDocument(app ghost.App) (map[string]json.RawMessage, error) {
+	app.EveItemMetadata = ghost.EveItemMetadata{}
+	app.User = ""
+	app.PendingChanges = nil
+	if app.Modules != nil {
+		modules := make([]ghost.Module, len(*app.Modules))
+		for i, module := range *app.Modules {
+			module.LastDeployment = ""
+			module.Initialized = nil
+			modules[i] = module
+		}
+		app.Modules = &modules
+	}
+
+	data, err := marshalGhostApp(app)
+	if err != nil {
+		return nil, err
+	}
+
+	document := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	delete(document, "user")
+
+	return document, nil
+}
+
+func ghostAppDocumentFields(app ghost.App) ([]string, error) {
+	document, err := ghostAppDocument(app)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{}
+	for field := range document {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return fields, nil
+}
+
+// Get the sorted fields which differ between two versions of an app
+func ghostAppChangedDocumentFields(base ghost.App, latest ghost.App) ([]string, error) {
+	baseDocument, err := ghostAppDocument(base)
+	if err != nil {
+		return nil, err
+	}
+	latestDocument, err := ghostAppDocument(latest)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []string{}
+	for field, value := range latestDocument {
+		if !bytes.Equal(value, baseDocument[field]) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	return fields, nil
+}
+
+// Get the PATCH body updating the given fields of an app
+func ghostAppPatch(app ghost.App, fields []string) (map[string]interface{}, error) {
+	data, err := marshalGhostApp(app)
+	if err != nil {
+		return nil, err
+	}
+
+	document := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	patch := map[string]interface{}{}
+	for _, field := range fields {
+		value, ok := document[field]
+		if !ok {
+			return nil, fmt.Errorf("unknown Ghost app field %s", field)
+		}
+		patch[field] = value
+	}
+
+	return patch, nil
+}
+
+// Set an app read from Ghost in state. The effective app is the one read from
+// Ghost with the provider defaults, which templates are rendered with.
+func flattenGhostApp(d *schema.ResourceData, app ghost.App, effective ghost.App) error {
+	// Scripts are decoded first so that nothing is set in state when one of
+	// them is invalid
+	var modules []interface{}
+	var err error
+	keyedModules, isKeyed := d.GetOk("keyed_modules")
+	if isKeyed {
+		configured := keyedModules.(*schema.Set).List()
+		modules, err = flattenGhostAppKeyedModules(app.Modules, ghostAppModulesOrders(configured))
+		if err != nil {
+			return fmt.Errorf("keyed_modules.%v", err)
+		}
+	} else {
+		modules, err = flattenGhostAppModules(app.Modules)
+		if err != nil {
+			return fmt.Errorf("modules.%v", err)
+		}
+	}
+	lifecycleHooks, err := flattenGhostAppLifecycleHooks(app.LifecycleHooks)
+	if err != nil {
+		return fmt.Errorf("lifecycle_hooks.%v", err)
+	}
+
+	environmentVariables, sensitiveEnvironmentVariables := splitGhostAppEnvironmentVariables(
+		app.EnvironmentVariables, ghostAppEnvironmentVariablesKeys(d.Get("sensitive_environment_variables").([]interface{})))
+
+	// Keep the configured templates as long as they render to the scripts in Ghost
+	if d.Get("render_templates").(bool) {
+		configuredModules := d.Get("modules").([]interface{})
+		if isKeyed {
+			configuredModules = keyedModules.(*schema.Set).List()
+		}
+		data := newGhostAppTemplateData(effective, environmentVariables)
+		flattenGhostAppModulesTemplates(modules, configuredModules, data)
+		flattenGhostAppLifecycleHooksTemplates(lifecycleHooks, d.Get("lifecycle_hooks").([]interface{}), data)
+	}
+
+	salt := ghostAppHashSalt(d)
+	d.Set("name", app.Name)
+	d.Set("env", app.Env)
 	d.Set("role", app.Role)
 	d.Set("description", app.Description)
 	d.Set("region", app.Region)
@@ -585,68 +1313,292 @@ func flattenGhostApp(d *schema.ResourceData, app ghost.App) error {
 	d.Set("vpc_id", app.VpcID)
 	d.Set("instance_monitoring", app.InstanceMonitoring)
 	d.Set("etag", app.Etag)
-
-	d.Set("modules", flattenGhostAppModules(app.Modules))
+	d.Set("created_at", app.Created)
+	d.Set("updated_at", app.Updated)
+	d.Set("version", app.Version)
+	d.Set("last_modified_by", app.User)
+	d.Set("pending_changes", flattenGhostAppPendingChanges(app.PendingChanges))
+	d.Set("undeployed_modules", flattenGhostAppUndeployedModules(app.Modules))
+
+	if isKeyed {
+		d.Set("keyed_modules", flattenGhostAppModulesScriptFiles(modules, keyedModules.(*schema.Set).List(), salt))
+	} else {
+		d.Set("modules", flattenGhostAppModulesScriptFiles(modules, d.Get("modules").([]interface{}), salt))
+	}
 	d.Set("build_infos", flattenGhostAppBuildInfos(app.BuildInfos))
 	d.Set("environment_infos", flattenGhostAppEnvironmentInfos(app.EnvironmentInfos))
-	d.Set("features", flattenGhostAppFeatures(app.Features))
+	d.Set("features", flattenGhostAppFeaturesParameterBlocks(flattenGhostAppFeatures(app.Features),
+		d.Get("features").([]interface{})))
 	d.Set("autoscale", flattenGhostAppAutoscale(app.Autoscale))
-	d.Set("lifecycle_hooks", flattenGhostAppLifecycleHooks(app.LifecycleHooks))
+	d.Set("lifecycle_hooks", flattenGhostAppLifecycleHooksScriptFiles(
+		lifecycleHooks, d.Get("lifecycle_hooks").([]interface{}), salt))
+	d.Set("scripts_diff", "")
 	d.Set("log_notifications", flattenGhostAppStringList(app.LogNotifications))
-	d.Set("environment_variables", flattenGhostAppEnvironmentVariables(app.EnvironmentVariables))
+
+	if _, ok := d.GetOk("environment_variables_map"); ok {
+		d.Set("environment_variables_map", flattenGhostAppEnvironmentVariablesMap(environmentVariables))
+	} else {
+		d.Set("environment_variables", flattenGhostAppEnvironmentVariables(environmentVariables))
+	}
+	d.Set("sensitive_environment_variables", flattenGhostAppSensitiveEnvironmentVariables(sensitiveEnvironmentVariables, salt))
+
 	d.Set("safe_deployment", flattenGhostAppSafeDeployment(app.SafeDeployment))
 
 	return nil
 }
 
+// Get the salt of the hashes stored in state in place of sensitive values,
+// generating it for apps which don't have one yet
+func ghostAppHashSalt(d *schema.ResourceData) string {
+	if salt := d.Get("hash_salt").(string); salt != "" {
+		return salt
+	}
+	salt := NewHashSalt()
+	d.Set("hash_salt", salt)
+	return salt
+}
+
+func flattenGhostAppPendingChanges(pendingChanges *[]ghost.PendingChange) []interface{} {
+	values := []interface{}{}
+
+	if pendingChanges == nil {
+		return values
+	}
+
+	for _, pendingChange := range *pendingChanges {
+		values = append(values, map[string]interface{}{
+			"field":   pendingChange.Field,
+			"updated": pendingChange.Updated,
+			"user":    pendingChange.User,
+		})
+	}
+
+	return values
+}
+
+func ghostAppPendingChangesFields(pendingChanges []ghost.PendingChange) string {
+	fields := []string{}
+	for _, pendingChange := range pendingChanges {
+		fields = append(fields, fmt.Sprintf("%s (updated %s by %s)",
+			pendingChange.Field, pendingChange.Updated, pendingChange.User))
+	}
+
+	return strings.Join(fields, ", ")
+}
+
+// Get the URL of the app in the Ghost API from its Eve self link
+func ghostAppAPIURL(endpoint string, app ghost.App) string {
+	if app.Links == nil || app.Links.Self.Href == "" {
+		return ""
+	}
+
+	return strings.TrimSuffix(endpoint, "/") + "/" + strings.TrimPrefix(app.Links.Self.Href, "/")
+}
+
 // Get modules from TF configuration
-func expandGhostAppModules(d []interface{}) *[]ghost.Module {
+func expandGhostAppModules(d []interface{}) (*[]ghost.Module, error) {
 	modules := &[]ghost.Module{}
 
 	// Add each module to modules list
 	for _, config := range d {
 		data := config.(map[string]interface{})
 		module := ghost.Module{
-			Name:           data["name"].(string),
-			GitRepo:        data["git_repo"].(string),
-			Scope:          data["scope"].(string),
-			Path:           data["path"].(string),
-			BuildPack:      StrToB64(data["build_pack"].(string)),
-			PreDeploy:      StrToB64(data["pre_deploy"].(string)),
-			PostDeploy:     StrToB64(data["post_deploy"].(string)),
-			AfterAllDeploy: StrToB64(data["after_all_deploy"].(string)),
-			GID:            data["gid"].(int),
-			UID:            data["uid"].(int),
+			Name:    data["name"].(string),
+			GitRepo: data["git_repo"].(string),
+			Scope:   data["scope"].(string),
+			Path:    data["path"].(string),
+			GID:     data["gid"].(int),
+			UID:     data["uid"].(int),
+		}
+
+		scripts := ghostAppModuleScripts(&module)
+		for _, name := range ghostAppModuleScriptNames {
+			script, err := expandGhostAppScript(data, name)
+			if err != nil {
+				return nil, fmt.Errorf("module %s: %v", module.Name, err)
+			}
+			*scripts[name] = script
 		}
 
 		*modules = append(*modules, module)
 	}
 
-	return modules
+	return modules, nil
+}
+
+var ghostAppModuleScriptNames = []string{"build_pack", "pre_deploy", "post_deploy", "after_all_deploy"}
+
+// Get the scripts of a module by attribute name
+func ghostAppModuleScripts(module *ghost.Module) map[string]*string {
+	return map[string]*string{
+		"build_pack":       &module.BuildPack,
+		"pre_deploy":       &module.PreDeploy,
+		"post_deploy":      &module.PostDeploy,
+		"after_all_deploy": &module.AfterAllDeploy,
+	}
+}
+
+// Get a base64 encoded script from TF configuration, either set inline or
+// read from the file given by the <name>_file attribute
+func expandGhostAppScript(data map[string]interface{}, name string) (string, error) {
+	file, _ := data[name+"_file"].(string)
+	if file == "" {
+		return StrToB64(data[name].(string)), nil
+	}
+
+	// Scripts that didn't change are only known by their hash in state
+	if IsHashSum(file) {
+		return StrToB64(file), nil
+	}
+
+	script, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("%s_file: %v", name, err)
+	}
+
+	return StrToB64(string(script)), nil
 }
 
-func flattenGhostAppModules(modules *[]ghost.Module) []interface{} {
+// Replace scripts configured from files by their hash and a preview
+func flattenGhostAppScriptFiles(values map[string]interface{}, configured map[string]interface{}, names []string,
+	salt string) {
+	previews := map[string]interface{}{}
+
+	for _, name := range names {
+		values[name+"_file"] = ""
+
+		if file, _ := configured[name+"_file"].(string); file == "" {
+			continue
+		}
+
+		script := values[name].(string)
+		values[name+"_file"] = HashSum(salt, script)
+		values[name] = ""
+		previews[name] = ScriptPreview(script)
+	}
+
+	values["file_previews"] = previews
+}
+
+func flattenGhostAppModulesScriptFiles(moduleList []interface{}, configured []interface{}, salt string) []interface{} {
+	configuredModules := map[string]map[string]interface{}{}
+	for _, config := range configured {
+		data := config.(map[string]interface{})
+		configuredModules[data["name"].(string)] = data
+	}
+
+	for _, module := range moduleList {
+		values := module.(map[string]interface{})
+		flattenGhostAppScriptFiles(values, configuredModules[values["name"].(string)],
+			ghostAppModuleScriptNames, salt)
+	}
+
+	return moduleList
+}
+
+func flattenGhostAppModules(modules *[]ghost.Module) ([]interface{}, error) {
 	moduleList := []interface{}{}
 
-	for _, module := range *modules {
+	if modules == nil {
+		return moduleList, nil
+	}
+
+	for i, module := range *modules {
 		values := map[string]interface{}{
-			"name":             module.Name,
-			"git_repo":         module.GitRepo,
-			"path":             module.Path,
-			"scope":            module.Scope,
-			"uid":              module.UID,
-			"gid":              module.GID,
-			"build_pack":       B64ToStr(module.BuildPack),
-			"pre_deploy":       B64ToStr(module.PreDeploy),
-			"post_deploy":      B64ToStr(module.PostDeploy),
-			"after_all_deploy": B64ToStr(module.AfterAllDeploy),
-			"last_deployment":  module.LastDeployment,
+			"name":            module.Name,
+			"git_repo":        module.GitRepo,
+			"path":            module.Path,
+			"scope":           module.Scope,
+			"uid":             module.UID,
+			"gid":             module.GID,
+			"last_deployment": module.LastDeployment,
+		}
+
+		initialized := module.Initialized != nil && *module.Initialized
+		values["initialized"] = initialized
+		values["needs_initial_deploy"] = !initialized
+
+		scripts := ghostAppModuleScripts(&(*modules)[i])
+		for _, name := range ghostAppModuleScriptNames {
+			script, err := B64ToStr(*scripts[name])
+			if err != nil {
+				return nil, fmt.Errorf("%d.%s (module %s): %v", i, name, module.Name, err)
+			}
+			values[name] = script
 		}
 
 		moduleList = append(moduleList, values)
 	}
 
-	return moduleList
+	return moduleList, nil
+}
+
+// Get the names of the modules which were never deployed
+func flattenGhostAppUndeployedModules(modules *[]ghost.Module) []interface{} {
+	names := []interface{}{}
+
+	if modules == nil {
+		return names
+	}
+
+	for _, module := range *modules {
+		if module.Initialized == nil || !*module.Initialized {
+			names = append(names, module.Name)
+		}
+	}
+
+	return names
+}
+
+// Get keyed_modules from TF configuration, sorted by order then name
+func expandGhostAppKeyedModules(d []interface{}) (*[]ghost.Module, error) {
+	sorted := make([]interface{}, len(d))
+	copy(sorted, d)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a := sorted[i].(map[string]interface{})
+		b := sorted[j].(map[string]interface{})
+		if a["order"].(int) != b["order"].(int) {
+			return a["order"].(int) < b["order"].(int)
+		}
+		return a["name"].(string) < b["name"].(string)
+	})
+
+	return expandGhostAppModules(sorted)
+}
+
+// Flatten modules as keyed_modules, keeping the known order of each module
+// as long as it is consistent with the order of the modules in Ghost
+func flattenGhostAppKeyedModules(modules *[]ghost.Module, orders map[string]int) ([]interface{}, error) {
+	moduleList, err := flattenGhostAppModules(modules)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := -1
+	for _, module := range moduleList {
+		values := module.(map[string]interface{})
+
+		order, ok := orders[values["name"].(string)]
+		if !ok || order <= previous {
+			order = previous + 1
+		}
+		values["order"] = order
+		previous = order
+	}
+
+	return moduleList, nil
+}
+
+func ghostAppModulesOrders(d []interface{}) map[string]int {
+	orders := map[string]int{}
+
+	for _, config := range d {
+		data := config.(map[string]interface{})
+		orders[data["name"].(string)] = data["order"].(int)
+	}
+
+	return orders
 }
 
 // Get environment variables from TF configuration
@@ -685,6 +1637,354 @@ func flattenGhostAppEnvironmentVariables(environmentVariables *[]ghost.Environme
 	return environmentVariableList
 }
 
+// Get environment variables from TF configuration map, sorted by key
+func expandGhostAppEnvironmentVariablesMap(d map[string]interface{}) *[]ghost.EnvironmentVariable {
+	environmentVariables := &[]ghost.EnvironmentVariable{}
+
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		environmentVariable := ghost.EnvironmentVariable{
+			Key:   key,
+			Value: d[key].(string),
+		}
+
+		*environmentVariables = append(*environmentVariables, environmentVariable)
+	}
+
+	return environmentVariables
+}
+
+func flattenGhostAppEnvironmentVariablesMap(environmentVariables *[]ghost.EnvironmentVariable) map[string]interface{} {
+	environmentVariableMap := map[string]interface{}{}
+
+	if environmentVariables == nil {
+		return nil
+	}
+
+	for _, environmentVariable := range *environmentVariables {
+		environmentVariableMap[environmentVariable.Key] = environmentVariable.Value
+	}
+
+	return environmentVariableMap
+}
+
+func flattenGhostAppSensitiveEnvironmentVariables(environmentVariables *[]ghost.EnvironmentVariable,
+	salt string) []interface{} {
+	environmentVariableList := []interface{}{}
+
+	if environmentVariables == nil {
+		return nil
+	}
+
+	// Only a hash of the values is kept in state
+	for _, environmentVariable := range *environmentVariables {
+		values := map[string]interface{}{
+			"key":   environmentVariable.Key,
+			"value": HashSum(salt, environmentVariable.Value),
+		}
+
+		environmentVariableList = append(environmentVariableList, values)
+	}
+
+	return environmentVariableList
+}
+
+func ghostAppEnvironmentVariablesKeys(d []interface{}) []string {
+	keys := []string{}
+
+	for _, config := range d {
+		data := config.(map[string]interface{})
+		keys = append(keys, data["key"].(string))
+	}
+
+	return keys
+}
+
+// Split environment variables returned by Ghost between regular variables and
+// the ones whose key is in sensitiveKeys, sensitive ones following keys order
+func splitGhostAppEnvironmentVariables(environmentVariables *[]ghost.EnvironmentVariable,
+	sensitiveKeys []string) (*[]ghost.EnvironmentVariable, *[]ghost.EnvironmentVariable) {
+	if environmentVariables == nil {
+		return nil, nil
+	}
+
+	regular := &[]ghost.EnvironmentVariable{}
+	sensitive := &[]ghost.EnvironmentVariable{}
+
+	isSensitive := map[string]bool{}
+	for _, key := range sensitiveKeys {
+		isSensitive[key] = true
+	}
+
+	values := map[string]ghost.EnvironmentVariable{}
+	for _, environmentVariable := range *environmentVariables {
+		if isSensitive[environmentVariable.Key] {
+			values[environmentVariable.Key] = environmentVariable
+			continue
+		}
+		*regular = append(*regular, environmentVariable)
+	}
+
+	for _, key := range sensitiveKeys {
+		if environmentVariable, ok := values[key]; ok {
+			*sensitive = append(*sensitive, environmentVariable)
+		}
+	}
+
+	return regular, sensitive
+}
+
+// Replace values that are only known by their hash with the value currently
+// stored in Ghost. Only the values of sensitive variables are hashed, the
+// regular ones being sent as is even if they look like a hash.
+func resolveGhostAppEnvironmentVariables(environmentVariables *[]ghost.EnvironmentVariable,
+	current *[]ghost.EnvironmentVariable, sensitiveKeys []string, salt string) error {
+	currentValues := map[string]string{}
+	if current != nil {
+		for _, environmentVariable := range *current {
+			currentValues[environmentVariable.Key] = environmentVariable.Value
+		}
+	}
+
+	for i, environmentVariable := range *environmentVariables {
+		if !isGhostAppHashedEnvironmentVariable(environmentVariable, sensitiveKeys) {
+			continue
+		}
+		value, ok := currentValues[environmentVariable.Key]
+		if !ok || !HashSumMatches(salt, environmentVariable.Value, value) {
+			return fmt.Errorf("value of environment variable %s has changed in Ghost since "+
+				"last refresh, you should run plan again", environmentVariable.Key)
+		}
+		(*environmentVariables)[i].Value = value
+	}
+
+	return nil
+}
+
+func ghostAppHasHashedValues(app ghost.App, sensitiveKeys []string) bool {
+	for _, environmentVariable := range *app.EnvironmentVariables {
+		if isGhostAppHashedEnvironmentVariable(environmentVariable, sensitiveKeys) {
+			return true
+		}
+	}
+	for i := range *app.Modules {
+		for _, script := range ghostAppModuleScripts(&(*app.Modules)[i]) {
+			if isGhostAppHashedScript(*script) {
+				return true
+			}
+		}
+	}
+	for _, script := range ghostAppLifecycleHooksScripts(app.LifecycleHooks) {
+		if isGhostAppHashedScript(*script) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether a sensitive environment variable is only known by its hash
+func isGhostAppHashedEnvironmentVariable(environmentVariable ghost.EnvironmentVariable, sensitiveKeys []string) bool {
+	for _, key := range sensitiveKeys {
+		if key == environmentVariable.Key {
+			return IsHashSum(environmentVariable.Value)
+		}
+	}
+	return false
+}
+
+// Check whether an encoded script is only known by its hash
+func isGhostAppHashedScript(script string) bool {
+	decoded, err := B64ToStr(script)
+	return err == nil && IsHashSum(decoded)
+}
+
+// Replace values that are only known by their hash with the ones currently
+// stored in Ghost
+func resolveGhostAppHashedValues(app *ghost.App, current ghost.App, sensitiveKeys []string, salt string) error {
+	if err := resolveGhostAppEnvironmentVariables(app.EnvironmentVariables,
+		current.EnvironmentVariables, sensitiveKeys, salt); err != nil {
+		return err
+	}
+
+	currentModules := map[string]*ghost.Module{}
+	if current.Modules != nil {
+		for i, module := range *current.Modules {
+			currentModules[module.Name] = &(*current.Modules)[i]
+		}
+	}
+	for i, module := range *app.Modules {
+		scripts := ghostAppModuleScripts(&(*app.Modules)[i])
+		currentScripts := map[string]*string{}
+		if currentModule, ok := currentModules[module.Name]; ok {
+			currentScripts = ghostAppModuleScripts(currentModule)
+		}
+		for _, name := range ghostAppModuleScriptNames {
+			if err := resolveGhostAppScript(scripts[name], currentScripts[name], salt); err != nil {
+				return fmt.Errorf("module %s: %s %v", module.Name, name, err)
+			}
+		}
+	}
+
+	currentScripts := map[string]*string{}
+	if current.LifecycleHooks != nil {
+		currentScripts = ghostAppLifecycleHooksScripts(current.LifecycleHooks)
+	}
+	scripts := ghostAppLifecycleHooksScripts(app.LifecycleHooks)
+	for _, name := range ghostAppLifecycleHookNames {
+		if err := resolveGhostAppScript(scripts[name], currentScripts[name], salt); err != nil {
+			return fmt.Errorf("lifecycle_hooks: %s %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+func resolveGhostAppScript(script *string, current *string, salt string) error {
+	if !isGhostAppHashedScript(*script) {
+		return nil
+	}
+	hash, _ := B64ToStr(*script)
+	if current == nil {
+		return fmt.Errorf("script has changed in Ghost since last refresh, you should run plan again")
+	}
+	decoded, err := B64ToStr(*current)
+	if err != nil {
+		return fmt.Errorf("script stored in Ghost can't be decoded: %v", err)
+	}
+	if !HashSumMatches(salt, hash, decoded) {
+		return fmt.Errorf("script has changed in Ghost since last refresh, you should run plan again")
+	}
+	*script = *current
+	return nil
+}
+
+// Data available to the templates of module scripts and lifecycle hooks
+type ghostAppTemplateData struct {
+	App    ghost.App
+	Module ghost.Module
+	Vars   map[string]string
+}
+
+func newGhostAppTemplateData(app ghost.App, environmentVariables *[]ghost.EnvironmentVariable) ghostAppTemplateData {
+	vars := map[string]string{}
+	if environmentVariables != nil {
+		for _, environmentVariable := range *environmentVariables {
+			vars[environmentVariable.Key] = environmentVariable.Value
+		}
+	}
+
+	return ghostAppTemplateData{App: app, Vars: vars}
+}
+
+// Render a script with text/template, failing on undefined keys
+func renderGhostAppScript(script string, data ghostAppTemplateData) (string, error) {
+	tmpl, err := template.New("script").Option("missingkey=error").Parse(script)
+	if err != nil {
+		return "", err
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+
+	return rendered.String(), nil
+}
+
+// Render the templates of the module scripts and lifecycle hooks of an app
+func renderGhostAppScripts(app *ghost.App) error {
+	data := newGhostAppTemplateData(*app, app.EnvironmentVariables)
+
+	render := func(script *string, data ghostAppTemplateData) error {
+		// Scripts that didn't change are only known by their hash in state
+		if isGhostAppHashedScript(*script) {
+			return nil
+		}
+		decoded, err := B64ToStr(*script)
+		if err != nil {
+			return err
+		}
+		rendered, err := renderGhostAppScript(decoded, data)
+		if err != nil {
+			return err
+		}
+		*script = StrToB64(rendered)
+		return nil
+	}
+
+	for i, module := range *app.Modules {
+		data.Module = module
+		scripts := ghostAppModuleScripts(&(*app.Modules)[i])
+		for _, name := range ghostAppModuleScriptNames {
+			if err := render(scripts[name], data); err != nil {
+				return fmt.Errorf("module %s: %s: %v", module.Name, name, err)
+			}
+		}
+	}
+
+	data.Module = ghost.Module{}
+	scripts := ghostAppLifecycleHooksScripts(app.LifecycleHooks)
+	for _, name := range ghostAppLifecycleHookNames {
+		if err := render(scripts[name], data); err != nil {
+			return fmt.Errorf("lifecycle_hooks: %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Replace rendered scripts by their configured template when it still renders
+// to the same script
+func flattenGhostAppScriptsTemplates(values map[string]interface{}, configured map[string]interface{},
+	names []string, data ghostAppTemplateData) {
+	for _, name := range names {
+		script, _ := configured[name].(string)
+		if script == "" {
+			continue
+		}
+		if rendered, err := renderGhostAppScript(script, data); err == nil && rendered == values[name] {
+			values[name] = script
+		}
+	}
+}
+
+func flattenGhostAppModulesTemplates(moduleList []interface{}, configured []interface{}, data ghostAppTemplateData) {
+	configuredModules := map[string]map[string]interface{}{}
+	for _, config := range configured {
+		values := config.(map[string]interface{})
+		configuredModules[values["name"].(string)] = values
+	}
+
+	modules := map[string]ghost.Module{}
+	if data.App.Modules != nil {
+		for _, module := range *data.App.Modules {
+			modules[module.Name] = module
+		}
+	}
+
+	for _, module := range moduleList {
+		values := module.(map[string]interface{})
+		data.Module = modules[values["name"].(string)]
+		flattenGhostAppScriptsTemplates(values, configuredModules[values["name"].(string)],
+			ghostAppModuleScriptNames, data)
+	}
+}
+
+func flattenGhostAppLifecycleHooksTemplates(lifecycleHooksList []interface{}, configured []interface{},
+	data ghostAppTemplateData) {
+	if len(lifecycleHooksList) == 0 || len(configured) == 0 || configured[0] == nil {
+		return
+	}
+
+	flattenGhostAppScriptsTemplates(lifecycleHooksList[0].(map[string]interface{}),
+		configured[0].(map[string]interface{}), ghostAppLifecycleHookNames, data)
+}
+
 // Get autoscale from TF configuration
 func expandGhostAppAutoscale(d []interface{}) *ghost.Autoscale {
 	// If not defined, returns default autoscale struct
@@ -724,46 +2024,82 @@ func flattenGhostAppAutoscale(autoscale *ghost.Autoscale) []interface{} {
 }
 
 // Get lifecycle_hooks from TF configuration
-func expandGhostAppLifecycleHooks(d []interface{}) *ghost.LifecycleHooks {
+func expandGhostAppLifecycleHooks(d []interface{}) (*ghost.LifecycleHooks, error) {
 	// If not defined, returns default autoscale struct
-	if len(d) == 0 {
-		return &ghost.LifecycleHooks{}
+	if len(d) == 0 || d[0] == nil {
+		return &ghost.LifecycleHooks{}, nil
 	}
 
 	data := d[0].(map[string]interface{})
 
-	lifecycleHooks := &ghost.LifecycleHooks{
-		PreBuildimage:  StrToB64(data["pre_buildimage"].(string)),
-		PostBuildimage: StrToB64(data["post_buildimage"].(string)),
-		PreBootstrap:   StrToB64(data["pre_bootstrap"].(string)),
-		PostBootstrap:  StrToB64(data["post_bootstrap"].(string)),
+	lifecycleHooks := &ghost.LifecycleHooks{}
+
+	scripts := ghostAppLifecycleHooksScripts(lifecycleHooks)
+	for _, name := range ghostAppLifecycleHookNames {
+		script, err := expandGhostAppScript(data, name)
+		if err != nil {
+			return nil, fmt.Errorf("lifecycle_hooks: %v", err)
+		}
+		*scripts[name] = script
+	}
+
+	return lifecycleHooks, nil
+}
+
+var ghostAppLifecycleHookNames = []string{"pre_buildimage", "post_buildimage", "pre_bootstrap", "post_bootstrap"}
+
+// Get the scripts of lifecycle hooks by attribute name
+func ghostAppLifecycleHooksScripts(lifecycleHooks *ghost.LifecycleHooks) map[string]*string {
+	return map[string]*string{
+		"pre_buildimage":  &lifecycleHooks.PreBuildimage,
+		"post_buildimage": &lifecycleHooks.PostBuildimage,
+		"pre_bootstrap":   &lifecycleHooks.PreBootstrap,
+		"post_bootstrap":  &lifecycleHooks.PostBootstrap,
+	}
+}
+
+func flattenGhostAppLifecycleHooksScriptFiles(lifecycleHooksList []interface{}, configured []interface{},
+	salt string) []interface{} {
+	if len(lifecycleHooksList) == 0 {
+		return lifecycleHooksList
 	}
 
-	return lifecycleHooks
+	data := map[string]interface{}{}
+	if len(configured) > 0 && configured[0] != nil {
+		data = configured[0].(map[string]interface{})
+	}
+	flattenGhostAppScriptFiles(lifecycleHooksList[0].(map[string]interface{}), data,
+		ghostAppLifecycleHookNames, salt)
+
+	return lifecycleHooksList
 }
 
-func flattenGhostAppLifecycleHooks(lifecycleHooks *ghost.LifecycleHooks) []interface{} {
+func flattenGhostAppLifecycleHooks(lifecycleHooks *ghost.LifecycleHooks) ([]interface{}, error) {
 	values := []interface{}{}
 
 	if lifecycleHooks == nil {
-		return nil
+		return nil, nil
 	}
 
-	values = append(values, map[string]interface{}{
-		"pre_buildimage":  B64ToStr(lifecycleHooks.PreBuildimage),
-		"post_buildimage": B64ToStr(lifecycleHooks.PostBuildimage),
-		"pre_bootstrap":   B64ToStr(lifecycleHooks.PreBootstrap),
-		"post_bootstrap":  B64ToStr(lifecycleHooks.PostBootstrap),
-	})
+	hooks := map[string]interface{}{}
+	scripts := ghostAppLifecycleHooksScripts(lifecycleHooks)
+	for _, name := range ghostAppLifecycleHookNames {
+		script, err := B64ToStr(*scripts[name])
+		if err != nil {
+			return nil, fmt.Errorf("0.%s: %v", name, err)
+		}
+		hooks[name] = script
+	}
+	values = append(values, hooks)
 
-	return values
+	return values, nil
 }
 
 // Get features from TF configuration
-func expandGhostAppFeatures(d []interface{}) *[]ghost.Feature {
+func expandGhostAppFeatures(d []interface{}) (*[]ghost.Feature, error) {
 	features := &[]ghost.Feature{}
 
-	for _, config := range d {
+	for i, config := range d {
 		data := config.(map[string]interface{})
 
 		// Get parameters. If not defined, defaults to an empty dict
@@ -773,20 +2109,166 @@ func expandGhostAppFeatures(d []interface{}) *[]ghost.Feature {
 			param = `{}`
 		}
 		if err := json.Unmarshal([]byte(param.(string)), &jsonDoc); err != nil {
-			log.Printf("[ERROR] can't load feature.parameters json: %v", err)
+			return nil, fmt.Errorf("features.%d.parameters: invalid JSON: %v", i, err)
+		}
+
+		// Parameters can also be defined with parameter blocks
+		if parameters, ok := data["parameter"].([]interface{}); ok && len(parameters) > 0 {
+			if param.(string) != `{}` {
+				return nil, fmt.Errorf("features.%d: parameters and parameter can't be used together", i)
+			}
+			parametersMap, err := expandGhostAppFeatureParameters(parameters)
+			if err != nil {
+				return nil, fmt.Errorf("features.%d.%v", i, err)
+			}
+			jsonDoc = parametersMap
+		}
+
+		feature := ghost.Feature{
+			Name:        data["name"].(string),
+			Version:     data["version"].(string),
+			Provisioner: data["provisioner"].(string),
+			Parameters:  jsonDoc,
+		}
+
+		*features = append(*features, feature)
+	}
+
+	return features, nil
+}
+
+// Get parameters of a feature from parameter blocks, converting values to their type
+func expandGhostAppFeatureParameters(d []interface{}) (map[string]interface{}, error) {
+	parameters := map[string]interface{}{}
+
+	for i, config := range d {
+		data := config.(map[string]interface{})
+		name := data["name"].(string)
+
+		if _, ok := parameters[name]; ok {
+			return nil, fmt.Errorf("parameter.%d.name: %q is already defined", i, name)
+		}
+
+		value, err := ghostAppFeatureParameterValue(data["value"].(string), data["type"].(string))
+		if err != nil {
+			return nil, fmt.Errorf("parameter.%d.value: %v", i, err)
+		}
+		parameters[name] = value
+	}
+
+	return parameters, nil
+}
+
+func ghostAppFeatureParameterValue(value string, valueType string) (interface{}, error) {
+	switch valueType {
+	case "number":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return number, nil
+	case "bool":
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a bool", value)
+		}
+		return boolean, nil
+	case "json":
+		var jsonDoc interface{}
+		if err := json.Unmarshal([]byte(value), &jsonDoc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		return jsonDoc, nil
+	}
+
+	return value, nil
+}
+
+// Convert the parameters of the features configured with parameter blocks,
+// keeping the order of the parameters names known in configuration
+func flattenGhostAppFeaturesParameterBlocks(featureList []interface{}, configured []interface{}) []interface{} {
+	for i, feature := range featureList {
+		if i >= len(configured) || configured[i] == nil {
+			continue
+		}
+		parameterBlocks, ok := configured[i].(map[string]interface{})["parameter"].([]interface{})
+		if !ok || len(parameterBlocks) == 0 {
+			continue
+		}
+
+		values := feature.(map[string]interface{})
+		var parameters interface{}
+		if values["parameters"] != nil {
+			if err := json.Unmarshal([]byte(values["parameters"].(string)), &parameters); err != nil {
+				continue
+			}
+		}
+		parametersMap, ok := parameters.(map[string]interface{})
+		if !ok && parameters != nil {
+			continue
+		}
+
+		values["parameter"] = flattenGhostAppFeatureParameters(parametersMap, parameterBlocks)
+		values["parameters"] = ""
+	}
+
+	return featureList
+}
+
+func flattenGhostAppFeatureParameters(parameters map[string]interface{}, configured []interface{}) []interface{} {
+	parameterList := []interface{}{}
+
+	names := []string{}
+	types := map[string]string{}
+	for _, config := range configured {
+		data := config.(map[string]interface{})
+		names = append(names, data["name"].(string))
+		types[data["name"].(string)] = data["type"].(string)
+	}
+
+	// Parameters unknown from configuration are sorted by name
+	others := []string{}
+	for name := range parameters {
+		if _, ok := types[name]; !ok {
+			others = append(others, name)
 		}
+	}
+	sort.Strings(others)
 
-		feature := ghost.Feature{
-			Name:        data["name"].(string),
-			Version:     data["version"].(string),
-			Provisioner: data["provisioner"].(string),
-			Parameters:  jsonDoc,
+	for _, name := range append(names, others...) {
+		value, ok := parameters[name]
+		if !ok {
+			continue
 		}
 
-		*features = append(*features, feature)
+		parameter := map[string]interface{}{
+			"name": name,
+		}
+		switch v := value.(type) {
+		case string:
+			parameter["type"] = "string"
+			parameter["value"] = v
+		case float64:
+			parameter["type"] = "number"
+			parameter["value"] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			parameter["type"] = "bool"
+			parameter["value"] = strconv.FormatBool(v)
+		default:
+			parameter["type"] = "json"
+			valueJSON, _ := json.Marshal(v)
+			parameter["value"] = string(valueJSON)
+		}
+		if types[name] == "json" && parameter["type"] != "json" {
+			valueJSON, _ := json.Marshal(value)
+			parameter["type"] = "json"
+			parameter["value"] = string(valueJSON)
+		}
+
+		parameterList = append(parameterList, parameter)
 	}
 
-	return features
+	return parameterList
 }
 
 func flattenGhostAppFeatures(features *[]ghost.Feature) []interface{} {
@@ -840,14 +2322,36 @@ func suppressDiffFeaturesParameters() schema.SchemaDiffSuppressFunc {
 	}
 }
 
+// Compare feature parameter values according to their type
+func suppressDiffFeatureParameterValue() schema.SchemaDiffSuppressFunc {
+	return func(k, old, new string, d *schema.ResourceData) bool {
+		valueType := d.Get(strings.TrimSuffix(k, ".value") + ".type").(string)
+		if valueType == "string" || valueType == "" {
+			return false
+		}
+
+		oldValue, err := ghostAppFeatureParameterValue(old, valueType)
+		if err != nil {
+			return false
+		}
+		newValue, err := ghostAppFeatureParameterValue(new, valueType)
+		if err != nil {
+			return false
+		}
+
+		return reflect.DeepEqual(oldValue, newValue)
+	}
+}
+
 // Get build_infos from TF configuration
 func expandGhostAppBuildInfos(d []interface{}) *ghost.BuildInfos {
 	data := d[0].(map[string]interface{})
 
 	buildInfos := &ghost.BuildInfos{
-		SshUsername: data["ssh_username"].(string),
-		SourceAmi:   data["source_ami"].(string),
-		SubnetID:    data["subnet_id"].(string),
+		SshUsername:          data["ssh_username"].(string),
+		SourceAmi:            data["source_ami"].(string),
+		SourceContainerImage: data["source_container_image"].(string),
+		SubnetID:             data["subnet_id"].(string),
 	}
 
 	return buildInfos
@@ -861,10 +2365,12 @@ func flattenGhostAppBuildInfos(buildInfos *ghost.BuildInfos) []interface{} {
 	}
 
 	values = append(values, map[string]interface{}{
-		"ssh_username": buildInfos.SshUsername,
-		"source_ami":   buildInfos.SourceAmi,
-		"ami_name":     buildInfos.AmiName,
-		"subnet_id":    buildInfos.SubnetID,
+		"ssh_username":           buildInfos.SshUsername,
+		"source_ami":             buildInfos.SourceAmi,
+		"ami_name":               buildInfos.AmiName,
+		"source_container_image": buildInfos.SourceContainerImage,
+		"container_image":        buildInfos.ContainerImage,
+		"subnet_id":              buildInfos.SubnetID,
 	})
 
 	return values
@@ -1015,6 +2521,71 @@ func flattenGhostAppInstanceTags(instanceTags *[]ghost.InstanceTag) []interface{
 	return InstanceTagList
 }
 
+// Add the default instance tags that are not set, sorted by name, after the
+// set ones
+func mergeGhostAppInstanceTags(instanceTags *[]ghost.InstanceTag, defaults map[string]string) *[]ghost.InstanceTag {
+	merged := &[]ghost.InstanceTag{}
+	names := map[string]bool{}
+	if instanceTags != nil {
+		for _, instanceTag := range *instanceTags {
+			*merged = append(*merged, instanceTag)
+			names[instanceTag.TagName] = true
+		}
+	}
+
+	defaultNames := []string{}
+	for name := range defaults {
+		if !names[name] {
+			defaultNames = append(defaultNames, name)
+		}
+	}
+	sort.Strings(defaultNames)
+	for _, name := range defaultNames {
+		*merged = append(*merged, ghost.InstanceTag{TagName: name, TagValue: defaults[name]})
+	}
+
+	return merged
+}
+
+// Remove the instance tags which have their default value, unless they're
+// configured
+func subtractGhostAppInstanceTags(instanceTags *[]ghost.InstanceTag, defaults map[string]string, configured []interface{}) *[]ghost.InstanceTag {
+	if instanceTags == nil {
+		return nil
+	}
+
+	names := map[string]bool{}
+	for _, config := range configured {
+		if data, ok := config.(map[string]interface{}); ok {
+			names[data["tag_name"].(string)] = true
+		}
+	}
+
+	remaining := &[]ghost.InstanceTag{}
+	for _, instanceTag := range *instanceTags {
+		if value, ok := defaults[instanceTag.TagName]; ok && value == instanceTag.TagValue && !names[instanceTag.TagName] {
+			continue
+		}
+		*remaining = append(*remaining, instanceTag)
+	}
+
+	return remaining
+}
+
+func flattenGhostAppInstanceTagsMap(instanceTags *[]ghost.InstanceTag) map[string]interface{} {
+	values := map[string]interface{}{}
+
+	if instanceTags == nil {
+		return values
+	}
+
+	for _, instanceTag := range *instanceTags {
+		values[instanceTag.TagName] = instanceTag.TagValue
+	}
+
+	return values
+}
+
 func expandGhostAppStringList(d []interface{}) []string {
 	stringList := []string{}
 
@@ -1100,6 +2671,57 @@ func flattenGhostAppSafeDeployment(safeDeployment *ghost.SafeDeployment) []inter
 	return values
 }
 
+// Remove plan diffs when the value in state is the hash of the configured one
+func suppressDiffHashedValue() schema.SchemaDiffSuppressFunc {
+	return func(k, old, new string, d *schema.ResourceData) bool {
+		return old != "" && HashSumMatches(d.Get("hash_salt").(string), old, new)
+	}
+}
+
+// Remove plan diffs when the value in state is the hash of the script file,
+// once rendered when templates are enabled
+func suppressDiffScriptFile() schema.SchemaDiffSuppressFunc {
+	return func(k, old, new string, d *schema.ResourceData) bool {
+		if !IsHashSum(old) || new == "" {
+			return false
+		}
+		if d.Get("render_templates").(bool) {
+			script, ok := renderedGhostAppScriptFile(d, k)
+			return ok && HashSumMatches(d.Get("hash_salt").(string), old, script)
+		}
+		script, err := ioutil.ReadFile(new)
+		return err == nil && HashSumMatches(d.Get("hash_salt").(string), old, string(script))
+	}
+}
+
+// Get the rendered script of a <name>_file attribute
+func renderedGhostAppScriptFile(d *schema.ResourceData, k string) (string, bool) {
+	app, err := expandGhostApp(d, ghostAppStateDefaultsClient(d))
+	if err != nil {
+		return "", false
+	}
+
+	parent := k[:strings.LastIndex(k, ".")]
+	name := strings.TrimSuffix(k[len(parent)+1:], "_file")
+
+	var scripts map[string]*string
+	if strings.HasPrefix(parent, "lifecycle_hooks.") {
+		scripts = ghostAppLifecycleHooksScripts(app.LifecycleHooks)
+	} else {
+		for i, module := range *app.Modules {
+			if module.Name == d.Get(parent+".name").(string) {
+				scripts = ghostAppModuleScripts(&(*app.Modules)[i])
+			}
+		}
+	}
+	if scripts == nil || scripts[name] == nil {
+		return "", false
+	}
+
+	script, err := B64ToStr(*scripts[name])
+	return script, err == nil
+}
+
 // Check that the struct is empty meaning that there's no change
 func hasNoChangeAutoscale(k string, d *schema.ResourceData) bool {
 	val, ok := d.GetOk("autoscale")
@@ -1116,7 +2738,10 @@ func hasNoChangeLifecycleHooks(k string, d *schema.ResourceData) bool {
 	if !ok {
 		return true
 	}
-	lifecycleHooks := expandGhostAppLifecycleHooks(val.([]interface{}))
+	lifecycleHooks, err := expandGhostAppLifecycleHooks(val.([]interface{}))
+	if err != nil {
+		return false
+	}
 	return lifecycleHooks == nil || (lifecycleHooks.PostBootstrap == "" &&
 		lifecycleHooks.PostBuildimage == "" && lifecycleHooks.PreBootstrap == "" &&
 		lifecycleHooks.PreBuildimage == "")
@@ -1174,3 +2799,537 @@ func suppressDiffSafeDeployment() schema.SchemaDiffSuppressFunc {
 			hasNoChangeSafeDeployment(k, d)
 	}
 }
+
+// Check attributes combinations that Ghost would reject, so that errors are
+// reported at plan time. Values that are not yet known are read as zero values,
+// so the checks using them are skipped.
+func resourceGhostAppCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	var errs *multierror.Error
+
+	if v, ok := d.GetOk("autoscale"); ok && ghostAppNewValuesKnown(d, "autoscale.0.min", "autoscale.0.max") {
+		errs = multierror.Append(errs, validateGhostAppAutoscale(
+			expandGhostAppAutoscale(v.([]interface{})))...)
+	}
+	if v, ok := d.GetOk("build_infos"); ok &&
+		ghostAppNewValuesKnown(d, "build_infos.0.source_ami", "build_infos.0.source_container_image") {
+		errs = multierror.Append(errs, validateGhostAppBuildInfos(
+			expandGhostAppBuildInfos(v.([]interface{})))...)
+	}
+	if v, ok := d.GetOk("safe_deployment"); ok && ghostAppNewValuesKnown(d, "safe_deployment.0.load_balancer_type",
+		"safe_deployment.0.ha_backend", "safe_deployment.0.api_port", "safe_deployment.0.app_tag_value") {
+		errs = multierror.Append(errs, validateGhostAppSafeDeployment(
+			expandGhostAppSafeDeployment(v.([]interface{})))...)
+	}
+	if v, ok := d.GetOk("environment_infos"); ok {
+		environmentInfos := expandGhostAppEnvironmentInfos(v.([]interface{}))
+		errs = multierror.Append(errs, validateGhostAppOptionalVolumes(
+			environmentInfos.OptionalVolumes)...)
+	}
+	if v, ok := d.GetOk("environment_variables_map"); ok {
+		errs = multierror.Append(errs, validateGhostAppEnvironmentVariables("environment_variables_map",
+			expandGhostAppEnvironmentVariablesMap(v.(map[string]interface{})),
+			expandGhostAppEnvironmentVariables(d.Get("sensitive_environment_variables").([]interface{})))...)
+	} else {
+		errs = multierror.Append(errs, validateGhostAppEnvironmentVariables("environment_variables",
+			expandGhostAppEnvironmentVariables(d.Get("environment_variables").([]interface{})),
+			expandGhostAppEnvironmentVariables(d.Get("sensitive_environment_variables").([]interface{})))...)
+	}
+	errs = multierror.Append(errs, validateGhostAppFeatures(d.Get("features").([]interface{}), d.NewValueKnown)...)
+
+	// An app without modules is configured with an empty modules list
+	_, hasModules := d.GetOkExists("modules")
+	_, hasKeyedModules := d.GetOkExists("keyed_modules")
+	if !hasModules && !hasKeyedModules {
+		errs = multierror.Append(errs, fmt.Errorf("one of modules or keyed_modules must be set"))
+	}
+	modulesConfig := d.Get("modules").([]interface{})
+	if v, ok := d.GetOk("keyed_modules"); ok {
+		modulesConfig = v.(*schema.Set).List()
+		errs = multierror.Append(errs, validateGhostAppKeyedModules(modulesConfig)...)
+	}
+	errs = multierror.Append(errs, validateGhostAppScripts(modulesConfig,
+		d.Get("lifecycle_hooks").([]interface{}))...)
+
+	var modules *[]ghost.Module
+	var err error
+	if _, ok := d.GetOk("keyed_modules"); ok {
+		modules, err = expandGhostAppKeyedModules(modulesConfig)
+	} else if modules, err = expandGhostAppModules(modulesConfig); err == nil {
+		errs = multierror.Append(errs, validateGhostAppModules(modules)...)
+	}
+	errs = multierror.Append(errs, err)
+	lifecycleHooks, err := expandGhostAppLifecycleHooks(d.Get("lifecycle_hooks").([]interface{}))
+	errs = multierror.Append(errs, err)
+
+	blueGreen := d.Get("blue_green").([]interface{})
+	for i := range blueGreen {
+		if !ghostAppNewValuesKnown(d, fmt.Sprintf("blue_green.%d.enable_blue_green", i),
+			fmt.Sprintf("blue_green.%d.color", i)) {
+			blueGreen[i] = nil
+		}
+	}
+	errs = multierror.Append(errs, validateGhostAppBlueGreen(blueGreen)...)
+	if client, ok := meta.(*GhostClient); ok {
+		errs = multierror.Append(errs, validateGhostAppCapabilities(d, client)...)
+	}
+
+	// Pending changes are the ones known since the last refresh
+	if d.Get("fail_on_pending_changes").(bool) {
+		errs = multierror.Append(errs, validateGhostAppPendingChanges(
+			d.Get("pending_changes").([]interface{}))...)
+	}
+
+	if errs.ErrorOrNil() != nil {
+		return errs
+	}
+
+	if err := customizeGhostAppEffectiveDefaults(d, meta); err != nil {
+		return err
+	}
+	if err := customizeGhostAppInstanceTagsAll(d, meta); err != nil {
+		return err
+	}
+
+	if d.Get("render_templates").(bool) {
+		client, _ := meta.(*GhostClient)
+		app, err := expandGhostApp(d, client)
+		if err != nil {
+			return err
+		}
+		modules, lifecycleHooks = app.Modules, app.LifecycleHooks
+	}
+
+	// Show the changed lines of scripts in the plan
+	if d.Id() != "" && (d.HasChange("modules") || d.HasChange("keyed_modules") || d.HasChange("lifecycle_hooks")) {
+		prior, err := ghostAppPriorScripts(d, meta)
+		if err != nil {
+			return err
+		}
+		scriptsDiff, err := ghostAppScriptsDiff(modules, lifecycleHooks, prior)
+		if err != nil {
+			return err
+		}
+		if scriptsDiff != "" {
+			d.SetNew("scripts_diff", scriptsDiff)
+		}
+	}
+
+	return nil
+}
+
+// Whether the values of all the given keys are known at plan time
+func ghostAppNewValuesKnown(d *schema.ResourceDiff, keys ...string) bool {
+	for _, key := range keys {
+		if !d.NewValueKnown(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// Show the instance tags sent to Ghost with the provider default ones, which
+// are not known yet if a configured tag isn't
+func customizeGhostAppInstanceTagsAll(d *schema.ResourceDiff, meta interface{}) error {
+	var defaults map[string]string
+	if client, ok := meta.(*GhostClient); ok {
+		defaults = client.DefaultInstanceTags
+	}
+
+	instanceTags := expandGhostAppInstanceTags(d.Get("environment_infos.0.instance_tags").([]interface{}))
+	for _, instanceTag := range *instanceTags {
+		if instanceTag.TagName == "" || instanceTag.TagValue == "" {
+			return d.SetNewComputed("instance_tags_all")
+		}
+	}
+
+	all := flattenGhostAppInstanceTagsMap(mergeGhostAppInstanceTags(instanceTags, defaults))
+	return setNewGhostAppComputedValue(d, "instance_tags_all", all)
+}
+
+// Show the values sent to Ghost for the attributes with a provider default.
+// Values set by neither the app nor the defaults are left to Ghost, except
+// vpc_id which is required.
+func customizeGhostAppEffectiveDefaults(d *schema.ResourceDiff, meta interface{}) error {
+	var defaults GhostAppDefaults
+	if client, ok := meta.(*GhostClient); ok {
+		defaults = client.Defaults
+	}
+	effective := effectiveGhostAppDefaults(d, defaults)
+
+	// Unknown values are read as empty at plan time, so this is only checked
+	// once they're known
+	if effective.VpcID == "" && ghostAppNewValuesKnown(d, "vpc_id") {
+		return fmt.Errorf("vpc_id must be set, either on the app or in the provider defaults")
+	}
+
+	values := map[string]interface{}{
+		"effective_region":            effective.Region,
+		"effective_vpc_id":            effective.VpcID,
+		"effective_log_notifications": flattenGhostAppStringList(effective.LogNotifications),
+		"effective_safe_deployment":   flattenGhostAppSafeDeployment(effective.SafeDeployment),
+	}
+	for key, value := range values {
+		var err error
+		if reflect.ValueOf(value).Len() == 0 {
+			err = d.Clear(key)
+		} else {
+			err = setNewGhostAppComputedValue(d, key, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Set the planned value of a computed attribute, removing its diff if it
+// doesn't change
+func setNewGhostAppComputedValue(d *schema.ResourceDiff, key string, value interface{}) error {
+	if reflect.DeepEqual(value, d.Get(key)) {
+		return d.Clear(key)
+	}
+	return d.SetNew(key, value)
+}
+
+// Prior state of an app, read from a ResourceDiff
+type ghostAppPriorState struct {
+	d *schema.ResourceDiff
+}
+
+func (s ghostAppPriorState) Get(key string) interface{} {
+	old, _ := s.d.GetChange(key)
+	return old
+}
+
+func (s ghostAppPriorState) GetOk(key string) (interface{}, bool) {
+	old := s.Get(key)
+	switch v := old.(type) {
+	case *schema.Set:
+		return v, v.Len() > 0
+	case []interface{}:
+		return v, len(v) > 0
+	case map[string]interface{}:
+		return v, len(v) > 0
+	}
+	return old, old != nil && !reflect.DeepEqual(old, reflect.Zero(reflect.TypeOf(old)).Interface())
+}
+
+// Get the scripts of an app as sent to Ghost by the last apply, from the prior
+// state. Scripts set from files are only known by their hash in state, so
+// they're read from Ghost, and left out of the diff if it can't be reached.
+func ghostAppPriorScripts(d *schema.ResourceDiff, meta interface{}) (ghost.App, error) {
+	state := ghostAppPriorState{d}
+	prior, err := expandGhostApp(state, ghostAppStateDefaultsClient(state))
+	if err != nil {
+		return ghost.App{}, fmt.Errorf("error reading the scripts of the prior state: %v", err)
+	}
+
+	client, ok := meta.(*GhostClient)
+	if !ok || !ghostAppHasHashedValues(prior, nil) {
+		return prior, nil
+	}
+	current, err := client.GetApp(d.Id())
+	if err != nil {
+		log.Printf("[WARN] Error reading Ghost app, scripts_diff leaves out the scripts set from files: %v", err)
+		return prior, nil
+	}
+	return current, nil
+}
+
+// Get the unified diff of the scripts which differ from the prior ones, left
+// out when either is only known by its hash
+func ghostAppScriptsDiff(modules *[]ghost.Module, lifecycleHooks *ghost.LifecycleHooks, current ghost.App) (string, error) {
+	var scriptsDiff bytes.Buffer
+
+	diff := func(path string, script string, currentScript string) error {
+		if isGhostAppHashedScript(script) || isGhostAppHashedScript(currentScript) {
+			return nil
+		}
+		decoded, _ := B64ToStr(script)
+		currentDecoded, err := B64ToStr(currentScript)
+		if err != nil {
+			return fmt.Errorf("%s: prior script can't be decoded: %v", path, err)
+		}
+		scriptsDiff.WriteString(UnifiedDiff(path, currentDecoded, decoded))
+		return nil
+	}
+
+	currentModules := map[string]*ghost.Module{}
+	if current.Modules != nil {
+		for i, module := range *current.Modules {
+			currentModules[module.Name] = &(*current.Modules)[i]
+		}
+	}
+	for i, module := range *modules {
+		scripts := ghostAppModuleScripts(&(*modules)[i])
+		currentScripts := ghostAppModuleScripts(&ghost.Module{})
+		if currentModule, ok := currentModules[module.Name]; ok {
+			currentScripts = ghostAppModuleScripts(currentModule)
+		}
+		for _, name := range ghostAppModuleScriptNames {
+			if err := diff(fmt.Sprintf("modules.%s.%s", module.Name, name),
+				*scripts[name], *currentScripts[name]); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	currentScripts := ghostAppLifecycleHooksScripts(&ghost.LifecycleHooks{})
+	if current.LifecycleHooks != nil {
+		currentScripts = ghostAppLifecycleHooksScripts(current.LifecycleHooks)
+	}
+	scripts := ghostAppLifecycleHooksScripts(lifecycleHooks)
+	for _, name := range ghostAppLifecycleHookNames {
+		if err := diff("lifecycle_hooks."+name, *scripts[name], *currentScripts[name]); err != nil {
+			return "", err
+		}
+	}
+
+	return scriptsDiff.String(), nil
+}
+
+func validateGhostAppAutoscale(autoscale *ghost.Autoscale) (errors []error) {
+	if autoscale.Min > autoscale.Max {
+		errors = append(errors, fmt.Errorf(
+			"autoscale.0.min (%d) must be lower than or equal to autoscale.0.max (%d)",
+			autoscale.Min, autoscale.Max))
+	}
+	return
+}
+
+func validateGhostAppSafeDeployment(safeDeployment *ghost.SafeDeployment) (errors []error) {
+	if safeDeployment.LoadBalancerType != "haproxy" {
+		return
+	}
+	if safeDeployment.HaBackend == "" {
+		errors = append(errors, fmt.Errorf(
+			"safe_deployment.0.ha_backend is required when load_balancer_type is \"haproxy\""))
+	}
+	if safeDeployment.ApiPort == 0 {
+		errors = append(errors, fmt.Errorf(
+			"safe_deployment.0.api_port is required when load_balancer_type is \"haproxy\""))
+	}
+	if safeDeployment.AppTagValue == "" {
+		errors = append(errors, fmt.Errorf(
+			"safe_deployment.0.app_tag_value is required when load_balancer_type is \"haproxy\""))
+	}
+	return
+}
+
+func validateGhostAppOptionalVolumes(optionalVolumes *[]ghost.OptionalVolume) (errors []error) {
+	devices := map[string]int{}
+
+	for i, volume := range *optionalVolumes {
+		if volume.Iops != 0 && volume.VolumeType != "" && volume.VolumeType != "io1" {
+			errors = append(errors, fmt.Errorf(
+				"environment_infos.0.optional_volumes.%d.iops can only be set on io1 volumes, got %q",
+				i, volume.VolumeType))
+		}
+
+		if volume.DeviceName == "" {
+			continue
+		}
+		if j, ok := devices[volume.DeviceName]; ok {
+			errors = append(errors, fmt.Errorf(
+				"environment_infos.0.optional_volumes.%d.device_name: %q is already used by optional_volumes.%d",
+				i, volume.DeviceName, j))
+			continue
+		}
+		devices[volume.DeviceName] = i
+	}
+	return
+}
+
+func validateGhostAppModules(modules *[]ghost.Module) (errors []error) {
+	names := map[string]int{}
+
+	for i, module := range *modules {
+		if module.Name == "" {
+			continue
+		}
+		if j, ok := names[module.Name]; ok {
+			errors = append(errors, fmt.Errorf(
+				"modules.%d.name: %q is already used by modules.%d", i, module.Name, j))
+			continue
+		}
+		names[module.Name] = i
+	}
+	return
+}
+
+// Check the parameters of features, skipping the values not known yet
+func validateGhostAppFeatures(d []interface{}, known func(key string) bool) (errors []error) {
+	for i, config := range d {
+		data, ok := config.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		parameters, _ := data["parameter"].([]interface{})
+		if len(parameters) == 0 {
+			continue
+		}
+
+		if data["parameters"].(string) != "" {
+			errors = append(errors, fmt.Errorf(
+				"features.%d: parameters and parameter can't be used together", i))
+		}
+
+		names := map[string]int{}
+		for j, parameter := range parameters {
+			values := parameter.(map[string]interface{})
+			name, value := values["name"].(string), values["value"].(string)
+
+			if k, ok := names[name]; ok {
+				errors = append(errors, fmt.Errorf(
+					"features.%d.parameter.%d.name: %q is already defined by parameter.%d", i, j, name, k))
+			} else {
+				names[name] = j
+			}
+
+			if !known(fmt.Sprintf("features.%d.parameter.%d.value", i, j)) {
+				continue
+			}
+			if _, err := ghostAppFeatureParameterValue(value, values["type"].(string)); err != nil {
+				errors = append(errors, fmt.Errorf("features.%d.parameter.%d.value: %v", i, j, err))
+			}
+		}
+	}
+	return
+}
+
+func validateGhostAppKeyedModules(d []interface{}) (errors []error) {
+	names := map[int]string{}
+	orders := map[string]int{}
+
+	// Sort modules by name for errors to be reported in a stable way
+	modules := make([]interface{}, len(d))
+	copy(modules, d)
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].(map[string]interface{})["name"].(string) <
+			modules[j].(map[string]interface{})["name"].(string)
+	})
+
+	for _, config := range modules {
+		data := config.(map[string]interface{})
+		name, order := data["name"].(string), data["order"].(int)
+		if previous, ok := orders[name]; ok {
+			errors = append(errors, fmt.Errorf(
+				"keyed_modules: module %q is defined with orders %d and %d", name, previous, order))
+			continue
+		}
+		orders[name] = order
+		if previous, ok := names[order]; ok {
+			errors = append(errors, fmt.Errorf(
+				"keyed_modules: order %d of module %q is already used by module %q", order, name, previous))
+			continue
+		}
+		names[order] = name
+	}
+	return
+}
+
+// Check that environment variable keys are unique across the regular variables,
+// defined by attribute, and the sensitive ones
+func validateGhostAppEnvironmentVariables(attribute string, environmentVariables *[]ghost.EnvironmentVariable,
+	sensitiveEnvironmentVariables *[]ghost.EnvironmentVariable) (errors []error) {
+	keys := map[string]string{}
+
+	check := func(path string, key string) {
+		if key == "" {
+			return
+		}
+		if previous, ok := keys[key]; ok {
+			errors = append(errors, fmt.Errorf("%s: %q is already defined by %s", path, key, previous))
+			return
+		}
+		keys[key] = path
+	}
+
+	for i, environmentVariable := range *environmentVariables {
+		if attribute == "environment_variables" {
+			check(fmt.Sprintf("environment_variables.%d.key", i), environmentVariable.Key)
+		} else {
+			check(fmt.Sprintf("%s.%s", attribute, environmentVariable.Key), environmentVariable.Key)
+		}
+	}
+	for i, environmentVariable := range *sensitiveEnvironmentVariables {
+		check(fmt.Sprintf("sensitive_environment_variables.%d.key", i), environmentVariable.Key)
+	}
+	return
+}
+
+func validateGhostAppEnvironmentVariablesMap(v interface{}, k string) (ws []string, errors []error) {
+	for key := range v.(map[string]interface{}) {
+		if _, errs := MatchesRegexp(`^[a-zA-Z_]+[a-zA-Z0-9_]*$`)(key, k+"."+key); len(errs) > 0 {
+			errors = append(errors, errs...)
+		}
+	}
+	return
+}
+
+// Check that images are built either from an AMI or a container image
+func validateGhostAppBuildInfos(buildInfos *ghost.BuildInfos) (errors []error) {
+	if (buildInfos.SourceAmi == "") == (buildInfos.SourceContainerImage == "") {
+		errors = append(errors, fmt.Errorf("build_infos: exactly one of source_ami or source_container_image must be set"))
+	}
+	return
+}
+
+// Check that the live infrastructure is up to date with the app
+func validateGhostAppPendingChanges(d []interface{}) (errors []error) {
+	if len(d) == 0 {
+		return
+	}
+
+	pendingChanges := []ghost.PendingChange{}
+	for _, config := range d {
+		data := config.(map[string]interface{})
+		pendingChanges = append(pendingChanges, ghost.PendingChange{
+			Field:   data["field"].(string),
+			Updated: data["updated"].(string),
+			User:    data["user"].(string),
+		})
+	}
+
+	return append(errors, fmt.Errorf("app has pending changes, a buildimage or deployment is needed: %s",
+		ghostAppPendingChangesFields(pendingChanges)))
+}
+
+// Check that scripts are either set inline or from a file
+func validateGhostAppScripts(modules []interface{}, lifecycleHooks []interface{}) (errors []error) {
+	check := func(path string, data map[string]interface{}, names []string) {
+		for _, name := range names {
+			script, _ := data[name].(string)
+			file, _ := data[name+"_file"].(string)
+			if script != "" && file != "" {
+				errors = append(errors, fmt.Errorf("%s: %s and %s_file can't be used together", path, name, name))
+			}
+		}
+	}
+
+	for _, config := range modules {
+		data := config.(map[string]interface{})
+		check("module "+data["name"].(string), data, ghostAppModuleScriptNames)
+	}
+	for _, config := range lifecycleHooks {
+		if data, ok := config.(map[string]interface{}); ok {
+			check("lifecycle_hooks", data, ghostAppLifecycleHookNames)
+		}
+	}
+	return
+}
+
+func validateGhostAppBlueGreen(d []interface{}) (errors []error) {
+	for i, config := range d {
+		data, ok := config.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if data["enable_blue_green"].(bool) && data["color"].(string) == "" {
+			errors = append(errors, fmt.Errorf(
+				"blue_green.%d.color is required when enable_blue_green is true", i))
+		}
+	}
+	return
+}
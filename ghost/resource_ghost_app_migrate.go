@@ -0,0 +1,115 @@
+package ghost
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func resourceGhostAppMigrateState(v int, is *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+	switch v {
+	case 0:
+		log.Println("[INFO] Found Ghost app state v0; migrating to v1")
+		var err error
+		if is, err = migrateGhostAppStateV0toV1(is); err != nil {
+			return is, err
+		}
+		fallthrough
+	case 1:
+		log.Println("[INFO] Found Ghost app state v1; migrating to v2")
+		return migrateGhostAppStateV1toV2(is)
+	default:
+		return is, fmt.Errorf("Unexpected schema version: %d", v)
+	}
+}
+
+// Version 1 adds attributes with defaults and computed lists and maps, which
+// would show a diff when missing from state
+func migrateGhostAppStateV0toV1(is *terraform.InstanceState) (*terraform.InstanceState, error) {
+	if is.Empty() {
+		log.Println("[DEBUG] Empty Ghost app state; nothing to migrate.")
+		return is, nil
+	}
+
+	log.Printf("[DEBUG] Ghost app attributes before migration: %#v", is.Attributes)
+
+	defaults := map[string]string{
+		"render_templates":        "false",
+		"fail_on_pending_changes": "false",
+		"etag_conflict_strategy":  "fail",
+		"pending_changes.#":       "0",
+		"undeployed_modules.#":    "0",
+	}
+	for _, list := range []string{"modules", "lifecycle_hooks"} {
+		count, _ := strconv.Atoi(is.Attributes[list+".#"])
+		for i := 0; i < count; i++ {
+			defaults[fmt.Sprintf("%s.%d.file_previews.%%", list, i)] = "0"
+		}
+	}
+	for k, v := range defaults {
+		if _, ok := is.Attributes[k]; !ok {
+			is.Attributes[k] = v
+		}
+	}
+
+	log.Printf("[DEBUG] Ghost app attributes after migration: %#v", is.Attributes)
+
+	return is, nil
+}
+
+// Version 2 adds the computed attributes showing the values sent to Ghost,
+// which are the configured ones as there were no provider defaults before
+func migrateGhostAppStateV1toV2(is *terraform.InstanceState) (*terraform.InstanceState, error) {
+	if is.Empty() {
+		log.Println("[DEBUG] Empty Ghost app state; nothing to migrate.")
+		return is, nil
+	}
+
+	log.Printf("[DEBUG] Ghost app attributes before migration: %#v", is.Attributes)
+
+	copies := map[string]string{
+		"region":            "effective_region",
+		"vpc_id":            "effective_vpc_id",
+		"log_notifications": "effective_log_notifications",
+		"safe_deployment":   "effective_safe_deployment",
+	}
+	for from, to := range copies {
+		if hasGhostAppStateAttribute(is, to) {
+			continue
+		}
+		for k, v := range is.Attributes {
+			if k == from || strings.HasPrefix(k, from+".") {
+				is.Attributes[to+strings.TrimPrefix(k, from)] = v
+			}
+		}
+	}
+
+	if !hasGhostAppStateAttribute(is, "instance_tags_all") {
+		count, _ := strconv.Atoi(is.Attributes["environment_infos.0.instance_tags.#"])
+		tags := map[string]string{}
+		for i := 0; i < count; i++ {
+			prefix := fmt.Sprintf("environment_infos.0.instance_tags.%d.", i)
+			tags[is.Attributes[prefix+"tag_name"]] = is.Attributes[prefix+"tag_value"]
+		}
+		is.Attributes["instance_tags_all.%"] = strconv.Itoa(len(tags))
+		for name, value := range tags {
+			is.Attributes["instance_tags_all."+name] = value
+		}
+	}
+
+	log.Printf("[DEBUG] Ghost app attributes after migration: %#v", is.Attributes)
+
+	return is, nil
+}
+
+func hasGhostAppStateAttribute(is *terraform.InstanceState, attribute string) bool {
+	for k := range is.Attributes {
+		if k == attribute || strings.HasPrefix(k, attribute+".") {
+			return true
+		}
+	}
+	return false
+}
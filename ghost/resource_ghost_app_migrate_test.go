@@ -0,0 +1,209 @@
+package ghost
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// State of a ghost_app written with schema version 0, loaded from
+// testdata/ghost_app_state_v0.json. The fixture was generated by creating the
+// app configured in TestResourceGhostAppMigrateStateNoDiff with the provider
+// at schema version 0, against a fake ghost server.
+func testGhostAppStateV0(t *testing.T) *terraform.InstanceState {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "ghost_app_state_v0.json"))
+	if err != nil {
+		t.Fatalf("Error reading the v0 state fixture: %v", err)
+	}
+	is := &terraform.InstanceState{}
+	if err := json.Unmarshal(data, is); err != nil {
+		t.Fatalf("Error decoding the v0 state fixture: %v", err)
+	}
+	return is
+}
+
+func TestResourceGhostAppMigrateState(t *testing.T) {
+	cases := map[string]struct {
+		StateVersion int
+		Attributes   map[string]string
+		Expected     map[string]string
+		Valid        bool
+	}{
+		"v0_1": {
+			StateVersion: 0,
+			Attributes:   testGhostAppStateV0(t).Attributes,
+			Expected: map[string]string{
+				"render_templates":                  "false",
+				"fail_on_pending_changes":           "false",
+				"etag_conflict_strategy":            "fail",
+				"pending_changes.#":                 "0",
+				"undeployed_modules.#":              "0",
+				"modules.0.file_previews.%":         "0",
+				"lifecycle_hooks.0.file_previews.%": "0",
+			},
+			Valid: true,
+		},
+		"v0_1_existing_values": {
+			StateVersion: 0,
+			Attributes: map[string]string{
+				"name":                   "wordpress",
+				"etag_conflict_strategy": "refresh_and_retry",
+			},
+			Expected: map[string]string{
+				"render_templates":        "false",
+				"fail_on_pending_changes": "false",
+				"etag_conflict_strategy":  "refresh_and_retry",
+			},
+			Valid: true,
+		},
+		"v1_2": {
+			StateVersion: 1,
+			Attributes: map[string]string{
+				"region":                                        "eu-west-1",
+				"vpc_id":                                        "vpc-1234567",
+				"log_notifications.#":                           "1",
+				"log_notifications.0":                           "ghost-devops@domain.com",
+				"safe_deployment.#":                             "1",
+				"safe_deployment.0.load_balancer_type":          "elb",
+				"environment_infos.#":                           "1",
+				"environment_infos.0.instance_tags.#":           "2",
+				"environment_infos.0.instance_tags.0.tag_name":  "Name",
+				"environment_infos.0.instance_tags.0.tag_value": "wordpress",
+				"environment_infos.0.instance_tags.1.tag_name":  "Type",
+				"environment_infos.0.instance_tags.1.tag_value": "front",
+			},
+			Expected: map[string]string{
+				"effective_region":                               "eu-west-1",
+				"effective_vpc_id":                               "vpc-1234567",
+				"effective_log_notifications.#":                  "1",
+				"effective_log_notifications.0":                  "ghost-devops@domain.com",
+				"effective_safe_deployment.#":                    "1",
+				"effective_safe_deployment.0.load_balancer_type": "elb",
+				"instance_tags_all.%":                            "2",
+				"instance_tags_all.Name":                         "wordpress",
+				"instance_tags_all.Type":                         "front",
+			},
+			Valid: true,
+		},
+		"v1_2_existing_values": {
+			StateVersion: 1,
+			Attributes: map[string]string{
+				"region":                  "eu-west-1",
+				"effective_region":        "eu-west-2",
+				"instance_tags_all.%":     "1",
+				"instance_tags_all.Owner": "ops",
+			},
+			Expected: map[string]string{
+				"effective_region":    "eu-west-2",
+				"instance_tags_all.%": "1",
+			},
+			Valid: true,
+		},
+		"unknown_version": {
+			StateVersion: 3,
+			Attributes:   testGhostAppStateV0(t).Attributes,
+			Valid:        false,
+		},
+	}
+
+	for name, tc := range cases {
+		is := &terraform.InstanceState{
+			ID:         "5b9f9d2a4f3e4a0001b7d8e1",
+			Attributes: tc.Attributes,
+		}
+		before := map[string]string{}
+		for k, v := range tc.Attributes {
+			before[k] = v
+		}
+
+		is, err := resourceGhostApp().MigrateState(tc.StateVersion, is, nil)
+		if tc.Valid != (err == nil) {
+			t.Fatalf("%s: unexpected output from MigrateState: %v", name, err)
+		}
+		if !tc.Valid {
+			continue
+		}
+
+		for k, v := range tc.Expected {
+			if is.Attributes[k] != v {
+				t.Fatalf("%s: bad %s after migration.\nExpected: %#v\nGiven:    %#v",
+					name, k, v, is.Attributes[k])
+			}
+		}
+		// Existing attributes are kept as is
+		for k, v := range before {
+			if is.Attributes[k] != v {
+				t.Fatalf("%s: %s changed during migration.\nExpected: %#v\nGiven:    %#v",
+					name, k, v, is.Attributes[k])
+			}
+		}
+	}
+}
+
+func TestResourceGhostAppMigrateStateEmpty(t *testing.T) {
+	is := &terraform.InstanceState{}
+	is, err := resourceGhostApp().MigrateState(0, is, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error from MigrateState: %v", err)
+	}
+	if !reflect.DeepEqual(is, &terraform.InstanceState{}) {
+		t.Fatalf("Unexpected output from MigrateState: %#v", is)
+	}
+}
+
+// The migrated v0 state doesn't show any diff with its configuration
+func TestResourceGhostAppMigrateStateNoDiff(t *testing.T) {
+	is, err := resourceGhostApp().MigrateState(0, testGhostAppStateV0(t), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error from MigrateState: %v", err)
+	}
+
+	c := testGhostAppRawConfig(t, map[string]interface{}{
+		"name":          "wordpress",
+		"env":           "dev",
+		"role":          "webfront",
+		"region":        "eu-west-1",
+		"instance_type": "t2.micro",
+		"vpc_id":        "vpc-1234567",
+		"build_infos": []interface{}{
+			map[string]interface{}{
+				"subnet_id":  "subnet-1234567",
+				"source_ami": "ami-1234567",
+			},
+		},
+		"environment_infos": []interface{}{
+			map[string]interface{}{
+				"instance_profile": "iam.ec2.demo",
+				"key_name":         "ghost-demo",
+			},
+		},
+		"environment_variables": []interface{}{
+			map[string]interface{}{"key": "myvar", "value": "myvalue"},
+		},
+		"log_notifications": []interface{}{"ghost-devops@domain.com"},
+		"modules": []interface{}{
+			map[string]interface{}{
+				"name":       "wordpress",
+				"path":       "/var/www",
+				"scope":      "code",
+				"git_repo":   "https://github.com/KnpLabs/KnpIpsum.git",
+				"pre_deploy": "#!/bin/bash\necho pre_deploy\n",
+			},
+		},
+		"features": []interface{}{
+			map[string]interface{}{"name": "php5", "version": "5.4", "provisioner": "salt"},
+		},
+	})
+
+	diff, err := resourceGhostApp().Diff(is, c, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error from Diff: %v", err)
+	}
+	if diff != nil && !diff.Empty() {
+		t.Fatalf("Unexpected diff after migration: %#v", diff.Attributes)
+	}
+}
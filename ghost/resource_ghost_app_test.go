@@ -1,23 +1,42 @@
 package ghost
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/quick"
 
 	"cloud-deploy.io/cloud-deploy-sdk-go"
-	"github.com/hashicorp/terraform/helper/acctest"
+	"cloud-deploy.io/terraform-provider-cloud-deploy/ghost/ghosttest"
+	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 )
 
 func TestAccGhostAppBasic(t *testing.T) {
+	testAccRecordedTest(t, func(r *ghosttest.Recorder) resource.TestCase {
+		return testAccGhostAppBasicTestCase(t, r)
+	})
+}
+
+func testAccGhostAppBasicTestCase(t *testing.T, r *ghosttest.Recorder) resource.TestCase {
 	resourceName := "ghost_app.test"
-	envName := fmt.Sprintf("ghost_app_acc_env_basic_%s", acctest.RandString(10))
+	envName := fmt.Sprintf("ghost_app_acc_env_basic_%s", r.RandString(10))
 
-	resource.Test(t, resource.TestCase{
+	return resource.TestCase{
 		PreCheck:     func() { testAccPreCheck(t) },
 		Providers:    testAccProviders,
 		CheckDestroy: testAccCheckGhostAppDestroy,
@@ -32,6 +51,9 @@ func TestAccGhostAppBasic(t *testing.T) {
 					resource.TestCheckResourceAttr(resourceName, "log_notifications.0", "ghost-devops@domain.com"),
 					resource.TestCheckResourceAttr(resourceName, "autoscale.0.max", "3"),
 					resource.TestCheckResourceAttr(resourceName, "environment_variables.0.key", "myvar"),
+					resource.TestCheckResourceAttr(resourceName, "version", "1"),
+					resource.TestCheckResourceAttrSet(resourceName, "created_at"),
+					resource.TestCheckResourceAttrSet(resourceName, "api_url"),
 				),
 			},
 			{
@@ -44,6 +66,7 @@ func TestAccGhostAppBasic(t *testing.T) {
 					resource.TestCheckResourceAttr(resourceName, "log_notifications.0", "ghost-devops2@domain.com"),
 					resource.TestCheckResourceAttr(resourceName, "autoscale.0.max", "2"),
 					resource.TestCheckResourceAttr(resourceName, "environment_variables.0.key", "myvar2"),
+					resource.TestCheckResourceAttr(resourceName, "version", "2"),
 				),
 			},
 			{
@@ -62,9 +85,513 @@ func TestAccGhostAppBasic(t *testing.T) {
 				),
 			},
 		},
+	}
+}
+
+// Run the acceptance test steps against a fake Ghost API
+func TestGhostAppLifecycle(t *testing.T) {
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	resourceName := "ghost_app.test"
+	envName := "ghost_app_unit_env_basic"
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckGhostAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testGhostAppFakeConfig(server, testAccGhostAppConfig(envName)),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckGhostAppExists(resourceName),
+					resource.TestCheckResourceAttr(resourceName, "name", envName),
+					resource.TestCheckResourceAttr(resourceName, "region", "eu-west-1"),
+					resource.TestCheckResourceAttr(resourceName, "autoscale.0.max", "3"),
+					resource.TestCheckResourceAttr(resourceName, "modules.#", "2"),
+					resource.TestCheckResourceAttr(resourceName, "version", "1"),
+					resource.TestCheckResourceAttr(resourceName, "last_modified_by", ghosttest.Username),
+				),
+			},
+			{
+				Config: testGhostAppFakeConfig(server, testAccGhostAppConfigUpdated(envName)),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckGhostAppExists(resourceName),
+					resource.TestCheckResourceAttr(resourceName, "region", "eu-west-2"),
+					resource.TestCheckResourceAttr(resourceName, "autoscale.0.max", "2"),
+					resource.TestCheckResourceAttr(resourceName, "environment_variables.0.key", "myvar2"),
+					resource.TestCheckResourceAttr(resourceName, "version", "2"),
+				),
+			},
+			{
+				Config: testGhostAppFakeConfig(server, testAccGhostAppConfigOmitEmpty(envName)),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckGhostAppExists(resourceName),
+					resource.TestCheckResourceAttr(resourceName, "autoscale.0.max", "0"),
+					resource.TestCheckResourceAttr(resourceName, "modules.#", "0"),
+					resource.TestCheckResourceAttr(resourceName, "features.#", "0"),
+				),
+			},
+		},
+	})
+}
+
+// Get a configuration using the given fake Ghost API
+func testGhostAppFakeConfig(server *ghosttest.Server, config string) string {
+	return fmt.Sprintf(`
+      provider "ghost" {
+        user     = "%s"
+        password = "%s"
+        endpoint = "%s"
+      }
+	`, ghosttest.Username, ghosttest.Password, server.URL) + config
+}
+
+// Run the lifecycle of an app whose values are only known at apply time
+func TestGhostAppUnknownValues(t *testing.T) {
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	resourceName := "ghost_app.test"
+	envName := "ghost_app_unit_env_unknown"
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckGhostAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testGhostAppFakeConfig(server, testGhostAppConfigBase(envName)+testGhostAppConfigDefaults(envName, `
+				  vpc_id = "vpc-1234567"
+
+				  safe_deployment {
+				    load_balancer_type = "haproxy"
+				    ha_backend         = "${ghost_app.base.id}"
+				    api_port           = 5001
+				    app_tag_value      = "wordpress"
+				  }
+
+				  blue_green {
+				    enable_blue_green = true
+				    color             = "${ghost_app.base.id == "" ? "blue" : "green"}"
+				  }`)),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckGhostAppExists(resourceName),
+					resource.TestCheckResourceAttrPair(resourceName, "safe_deployment.0.ha_backend", "ghost_app.base", "id"),
+					resource.TestCheckResourceAttr(resourceName, "blue_green.0.color", "green"),
+				),
+			},
+		},
+	})
+}
+
+// Get the configuration of an app for other apps to refer to
+func testGhostAppConfigBase(name string) string {
+	return fmt.Sprintf(`
+      resource "ghost_app" "base" {
+        name   = "%s_base"
+        env    = "dev"
+        role   = "webfront"
+        vpc_id = "vpc-1234567"
+
+        build_infos = {
+          subnet_id  = "subnet-a7e849fe"
+          source_ami = "ami-03ce4474"
+        }
+
+        environment_infos = {
+          instance_profile = "iam.ec2.demo"
+          key_name         = "ghost-demo"
+        }
+
+        modules = []
+      }
+      `, name)
+}
+
+// Run the lifecycle of an app with provider default instance tags
+func TestGhostAppDefaultInstanceTags(t *testing.T) {
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	resourceName := "ghost_app.test"
+	envName := "ghost_app_unit_env_tags"
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckGhostAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testGhostAppFakeConfigWithTags(server, `Name = "default"
+				  Type = "front"
+				  CostCenter = "42"`, testAccGhostAppConfig(envName)),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testGhostAppCheckInstanceTags(resourceName, []ghost.InstanceTag{
+						{TagName: "Name", TagValue: "wordpress"},
+						{TagName: "Type", TagValue: "front"},
+						{TagName: "CostCenter", TagValue: "42"},
+					}),
+					resource.TestCheckResourceAttr(resourceName, "environment_infos.0.instance_tags.#", "2"),
+					resource.TestCheckResourceAttr(resourceName, "instance_tags_all.%", "3"),
+					resource.TestCheckResourceAttr(resourceName, "instance_tags_all.Name", "wordpress"),
+					resource.TestCheckResourceAttr(resourceName, "instance_tags_all.CostCenter", "42"),
+				),
+			},
+			{
+				Config: testGhostAppFakeConfigWithTags(server, `CostCenter = "43"
+				  Owner = "ops"`, testAccGhostAppConfig(envName)),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testGhostAppCheckInstanceTags(resourceName, []ghost.InstanceTag{
+						{TagName: "Name", TagValue: "wordpress"},
+						{TagName: "Type", TagValue: "front"},
+						{TagName: "CostCenter", TagValue: "43"},
+						{TagName: "Owner", TagValue: "ops"},
+					}),
+					resource.TestCheckResourceAttr(resourceName, "environment_infos.0.instance_tags.#", "2"),
+					resource.TestCheckResourceAttr(resourceName, "instance_tags_all.%", "4"),
+					resource.TestCheckResourceAttr(resourceName, "version", "2"),
+				),
+			},
+			{
+				Config: testGhostAppFakeConfig(server, testAccGhostAppConfig(envName)),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testGhostAppCheckInstanceTags(resourceName, []ghost.InstanceTag{
+						{TagName: "Name", TagValue: "wordpress"},
+						{TagName: "Type", TagValue: "front"},
+					}),
+					resource.TestCheckResourceAttr(resourceName, "instance_tags_all.%", "2"),
+				),
+			},
+		},
+	})
+}
+
+// Get a configuration using the given fake Ghost API and default instance tags
+func testGhostAppFakeConfigWithTags(server *ghosttest.Server, tags string, config string) string {
+	return fmt.Sprintf(`
+      provider "ghost" {
+        user     = "%s"
+        password = "%s"
+        endpoint = "%s"
+
+        default_instance_tags = {
+          %s
+        }
+      }
+	`, ghosttest.Username, ghosttest.Password, server.URL, tags) + config
+}
+
+// Check the instance tags of an app in Ghost
+func testGhostAppCheckInstanceTags(name string, expected []ghost.InstanceTag) resource.TestCheckFunc {
+	return testGhostAppCheckGhostValue(name, "instance tags", expected, func(app ghost.App) interface{} {
+		return *app.EnvironmentInfos.InstanceTags
+	})
+}
+
+// Check a value of an app in Ghost
+func testGhostAppCheckGhostValue(name string, description string, expected interface{}, value func(ghost.App) interface{}) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[name]
+		if !ok {
+			return fmt.Errorf("Not found: %s", name)
+		}
+
+		client := testAccProvider.Meta().(*GhostClient)
+		app, err := client.GetApp(rs.Primary.ID)
+		if err != nil {
+			return err
+		}
+		if given := value(app); !reflect.DeepEqual(given, expected) {
+			return fmt.Errorf("Unexpected %s in Ghost.\nExpected: %#v\nGiven:    %#v", description, expected, given)
+		}
+		return nil
+	}
+}
+
+// Run the lifecycle of an app using the provider defaults
+func TestGhostAppProviderDefaults(t *testing.T) {
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	resourceName := "ghost_app.test"
+	envName := "ghost_app_unit_env_defaults"
+	region := func(app ghost.App) interface{} { return app.Region }
+	vpcID := func(app ghost.App) interface{} { return app.VpcID }
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckGhostAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testGhostAppFakeConfigWithDefaults(server, "eu-west-1", testGhostAppConfigDefaults(envName, "")),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testGhostAppCheckGhostValue(resourceName, "region", "eu-west-1", region),
+					testGhostAppCheckGhostValue(resourceName, "vpc_id", "vpc-1234567", vpcID),
+					testGhostAppCheckGhostValue(resourceName, "log_notifications", []string{"ops@domain.com"},
+						func(app ghost.App) interface{} { return app.LogNotifications }),
+					testGhostAppCheckGhostValue(resourceName, "safe_deployment", ghost.SafeDeployment{
+						LoadBalancerType: "alb", WaitBeforeDeploy: 5, WaitAfterDeploy: 10,
+					}, func(app ghost.App) interface{} { return *app.SafeDeployment }),
+					resource.TestCheckResourceAttr(resourceName, "region", ""),
+					resource.TestCheckResourceAttr(resourceName, "vpc_id", ""),
+					resource.TestCheckResourceAttr(resourceName, "log_notifications.#", "0"),
+					resource.TestCheckResourceAttr(resourceName, "safe_deployment.#", "0"),
+					resource.TestCheckResourceAttr(resourceName, "effective_region", "eu-west-1"),
+					resource.TestCheckResourceAttr(resourceName, "effective_vpc_id", "vpc-1234567"),
+					resource.TestCheckResourceAttr(resourceName, "effective_log_notifications.0", "ops@domain.com"),
+					resource.TestCheckResourceAttr(resourceName, "effective_safe_deployment.0.load_balancer_type", "alb"),
+				),
+			},
+			{
+				Config: testGhostAppFakeConfigWithDefaults(server, "eu-west-3", testGhostAppConfigDefaults(envName, "")),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testGhostAppCheckGhostValue(resourceName, "region", "eu-west-3", region),
+					resource.TestCheckResourceAttr(resourceName, "region", ""),
+					resource.TestCheckResourceAttr(resourceName, "effective_region", "eu-west-3"),
+					resource.TestCheckResourceAttr(resourceName, "version", "2"),
+				),
+			},
+			{
+				Config: testGhostAppFakeConfigWithDefaults(server, "eu-west-3", testGhostAppConfigDefaults(envName, `
+				  region = "eu-west-3"
+				  vpc_id = "vpc-7654321"`)),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testGhostAppCheckGhostValue(resourceName, "vpc_id", "vpc-7654321", vpcID),
+					resource.TestCheckResourceAttr(resourceName, "region", "eu-west-3"),
+					resource.TestCheckResourceAttr(resourceName, "vpc_id", "vpc-7654321"),
+					resource.TestCheckResourceAttr(resourceName, "effective_vpc_id", "vpc-7654321"),
+				),
+			},
+			{
+				Config:      testGhostAppFakeConfig(server, testGhostAppConfigDefaults(envName, "")),
+				ExpectError: regexp.MustCompile("vpc_id must be set"),
+			},
+		},
+	})
+}
+
+// Run the lifecycle of an app on a Ghost version without ALB safe deployments
+func TestGhostAppCapabilities(t *testing.T) {
+	server := ghosttest.NewServerWithOptions(ghosttest.Options{Version: "17.06"})
+	defer server.Close()
+
+	resourceName := "ghost_app.test"
+	envName := "ghost_app_unit_env_capabilities"
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckGhostAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testGhostAppFakeConfigWithDefaults(server, "eu-west-1", testGhostAppConfigDefaults(envName, "")),
+				ExpectError: regexp.MustCompile(
+					`attribute safe_deployment.load_balancer_type = "alb" requires Cloud Deploy >= 17.12, the server runs 17.06`),
+			},
+			{
+				Config: testGhostAppFakeConfig(server, testGhostAppConfigDefaults(envName, `
+				  vpc_id = "vpc-1234567"
+
+				  safe_deployment {
+				    load_balancer_type = "haproxy"
+				    ha_backend         = "wordpress"
+				    api_port           = 5001
+				    app_tag_value      = "wordpress"
+				  }`)),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testAccCheckGhostAppExists(resourceName),
+					resource.TestCheckResourceAttr(resourceName, "safe_deployment.0.load_balancer_type", "haproxy"),
+				),
+			},
+		},
+	})
+}
+
+// Run the lifecycle of an app with a regular environment variable whose value
+// looks like a hash
+func TestGhostAppDigestEnvironmentVariable(t *testing.T) {
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	resourceName := "ghost_app.test"
+	envName := "ghost_app_unit_env_digest"
+	digest := "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"
+	config := func(variables string) string {
+		return testGhostAppFakeConfig(server, testGhostAppConfigDefaults(envName, fmt.Sprintf(`
+		  vpc_id = "vpc-1234567"
+		  %s
+
+		  sensitive_environment_variables = {
+		    key   = "password"
+		    value = "secret"
+		  }`, variables)))
+	}
+	environmentVariables := func(app ghost.App) interface{} { return *app.EnvironmentVariables }
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckGhostAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config(fmt.Sprintf(`
+				  environment_variables = {
+				    key   = "image"
+				    value = "%s"
+				  }`, digest)),
+				Check: resource.TestCheckResourceAttr(resourceName, "environment_variables.0.value", digest),
+			},
+			{
+				Config: config(fmt.Sprintf(`
+				  environment_variables = {
+				    key   = "image"
+				    value = "%s"
+				  }
+
+				  environment_variables = {
+				    key   = "tag"
+				    value = "latest"
+				  }`, digest)),
+				Check: testGhostAppCheckGhostValue(resourceName, "environment variables", []ghost.EnvironmentVariable{
+					{Key: "image", Value: digest},
+					{Key: "tag", Value: "latest"},
+					{Key: "password", Value: "secret"},
+				}, environmentVariables),
+			},
+		},
+	})
+}
+
+// Run the lifecycle of an app whose scripts are templates of other attributes
+func TestGhostAppTemplatesLifecycle(t *testing.T) {
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	resourceName := "ghost_app.test"
+	envName := "ghost_app_unit_env_templates"
+	config := func(description string) string {
+		return testGhostAppFakeConfig(server, testGhostAppConfigDefaults(envName, fmt.Sprintf(`
+		  vpc_id           = "vpc-1234567"
+		  description      = "%s"
+		  render_templates = true
+
+		  lifecycle_hooks {
+		    pre_bootstrap = "echo {{ .App.Description }}"
+		  }`, description)))
+	}
+	preBootstrap := func(app ghost.App) interface{} { return app.LifecycleHooks.PreBootstrap }
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckGhostAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config("first"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testGhostAppCheckGhostValue(resourceName, "pre_bootstrap", StrToB64("echo first"), preBootstrap),
+					resource.TestCheckResourceAttr(resourceName, "lifecycle_hooks.0.pre_bootstrap", "echo {{ .App.Description }}"),
+				),
+			},
+			{
+				Config: config("second"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testGhostAppCheckGhostValue(resourceName, "pre_bootstrap", StrToB64("echo second"), preBootstrap),
+					resource.TestCheckResourceAttr(resourceName, "lifecycle_hooks.0.pre_bootstrap", "echo {{ .App.Description }}"),
+				),
+			},
+		},
+	})
+}
+
+// Run the lifecycle of an app whose scripts are templates of attributes set
+// by the provider defaults
+func TestGhostAppTemplatesProviderDefaults(t *testing.T) {
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	resourceName := "ghost_app.test"
+	envName := "ghost_app_unit_env_templates_defaults"
+	config := func(region string) string {
+		return testGhostAppFakeConfigWithDefaults(server, region, testGhostAppConfigDefaults(envName, `
+		  render_templates = true
+
+		  lifecycle_hooks {
+		    pre_bootstrap = "echo {{ .App.Region }} {{ .App.VpcID }}"
+		  }`))
+	}
+	preBootstrap := func(app ghost.App) interface{} { return app.LifecycleHooks.PreBootstrap }
+
+	resource.UnitTest(t, resource.TestCase{
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckGhostAppDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config("eu-west-1"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testGhostAppCheckGhostValue(resourceName, "pre_bootstrap", StrToB64("echo eu-west-1 vpc-1234567"), preBootstrap),
+					resource.TestCheckResourceAttr(resourceName, "lifecycle_hooks.0.pre_bootstrap", "echo {{ .App.Region }} {{ .App.VpcID }}"),
+				),
+			},
+			{
+				Config: config("eu-west-3"),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					testGhostAppCheckGhostValue(resourceName, "pre_bootstrap", StrToB64("echo eu-west-3 vpc-1234567"), preBootstrap),
+					resource.TestCheckResourceAttr(resourceName, "lifecycle_hooks.0.pre_bootstrap", "echo {{ .App.Region }} {{ .App.VpcID }}"),
+				),
+			},
+		},
 	})
 }
 
+// Get a configuration using the given fake Ghost API and provider defaults
+func testGhostAppFakeConfigWithDefaults(server *ghosttest.Server, region string, config string) string {
+	return fmt.Sprintf(`
+      provider "ghost" {
+        user     = "%s"
+        password = "%s"
+        endpoint = "%s"
+
+        defaults {
+          region            = "%s"
+          vpc_id            = "vpc-1234567"
+          log_notifications = ["ops@domain.com"]
+
+          safe_deployment {
+            load_balancer_type = "alb"
+            wait_before_deploy = 5
+          }
+        }
+      }
+	`, ghosttest.Username, ghosttest.Password, server.URL, region) + config
+}
+
+// Get the configuration of an app leaving out the attributes with a provider
+// default, apart from the given ones
+func testGhostAppConfigDefaults(name string, attributes string) string {
+	return fmt.Sprintf(`
+      resource "ghost_app" "test" {
+        name = "%s"
+        env  = "dev"
+        role = "webfront"
+        %s
+
+        build_infos = {
+          subnet_id    = "subnet-a7e849fe"
+          ssh_username = "admin"
+          source_ami   = "ami-03ce4474"
+        }
+
+        environment_infos = {
+          instance_profile = "iam.ec2.demo"
+          key_name         = "ghost-demo"
+        }
+
+        modules = {
+          name     = "wordpress"
+          git_repo = "https://github.com/KnpLabs/KnpIpsum.git"
+          path     = "/var/www"
+          scope    = "code"
+        }
+      }
+      `, name, attributes)
+}
+
 func testAccCheckGhostAppExists(name string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		rs, ok := s.RootModule().Resources[name]
@@ -77,7 +604,7 @@ func testAccCheckGhostAppExists(name string) resource.TestCheckFunc {
 		}
 
 		log.Printf("[INFO] Try to connect to Ghost and get all apps")
-		client := testAccProvider.Meta().(*ghost.Client)
+		client := testAccProvider.Meta().(*GhostClient)
 		_, err := client.GetApps()
 		if err != nil {
 			return fmt.Errorf("Ghost environment not reachable: %v", err)
@@ -88,7 +615,7 @@ func testAccCheckGhostAppExists(name string) resource.TestCheckFunc {
 }
 
 func testAccCheckGhostAppDestroy(s *terraform.State) error {
-	client := testAccProvider.Meta().(*ghost.Client)
+	client := testAccProvider.Meta().(*GhostClient)
 
 	// Iterates through ghost apps
 	for _, rs := range s.RootModule().Resources {
@@ -102,7 +629,7 @@ func testAccCheckGhostAppDestroy(s *terraform.State) error {
 		// Try to get ghost app
 		_, err := client.GetApp(app_id)
 		if err == nil {
-			return fmt.Errorf("[INFO] Ghost app still exists: " + app_id)
+			return fmt.Errorf("[INFO] Ghost app still exists: %s", app_id)
 		}
 	}
 
@@ -474,28 +1001,113 @@ func TestExpandGhostAppInstanceTags(t *testing.T) {
 	}
 }
 
-func TestExpandGhostAppOptionalVolume(t *testing.T) {
+func TestMergeGhostAppInstanceTags(t *testing.T) {
 	cases := []struct {
-		Input          []interface{}
-		ExpectedOutput *[]ghost.OptionalVolume
+		Input          *[]ghost.InstanceTag
+		Defaults       map[string]string
+		ExpectedOutput *[]ghost.InstanceTag
 	}{
 		{
-			[]interface{}{
-				map[string]interface{}{
-					"device_name": "my_device",
-					"volume_type": "gp2",
-					"volume_size": 20,
-					"iops":        3000,
-					"launch_block_device_mappings": false,
-				},
+			&[]ghost.InstanceTag{{TagName: "Name", TagValue: "wordpress"}, {TagName: "Owner", TagValue: "web"}},
+			map[string]string{"Owner": "ops", "Environment": "prod", "CostCenter": "42"},
+			&[]ghost.InstanceTag{
+				{TagName: "Name", TagValue: "wordpress"},
+				{TagName: "Owner", TagValue: "web"},
+				{TagName: "CostCenter", TagValue: "42"},
+				{TagName: "Environment", TagValue: "prod"},
 			},
-			app.EnvironmentInfos.OptionalVolumes,
 		},
 		{
 			nil,
-			&[]ghost.OptionalVolume{},
+			map[string]string{"Owner": "ops"},
+			&[]ghost.InstanceTag{{TagName: "Owner", TagValue: "ops"}},
 		},
-	}
+		{
+			&[]ghost.InstanceTag{{TagName: "Name", TagValue: "wordpress"}},
+			nil,
+			&[]ghost.InstanceTag{{TagName: "Name", TagValue: "wordpress"}},
+		},
+	}
+
+	for _, tc := range cases {
+		output := mergeGhostAppInstanceTags(tc.Input, tc.Defaults)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from mergeGhostAppInstanceTags.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestSubtractGhostAppInstanceTags(t *testing.T) {
+	cases := []struct {
+		Input          *[]ghost.InstanceTag
+		Defaults       map[string]string
+		Configured     []interface{}
+		ExpectedOutput *[]ghost.InstanceTag
+	}{
+		// Default tags are removed, but not the ones overridden or configured
+		{
+			&[]ghost.InstanceTag{
+				{TagName: "Name", TagValue: "wordpress"},
+				{TagName: "Owner", TagValue: "web"},
+				{TagName: "Environment", TagValue: "prod"},
+				{TagName: "CostCenter", TagValue: "42"},
+			},
+			map[string]string{"Owner": "ops", "Environment": "prod", "CostCenter": "42"},
+			[]interface{}{
+				map[string]interface{}{"tag_name": "CostCenter", "tag_value": "42"},
+			},
+			&[]ghost.InstanceTag{
+				{TagName: "Name", TagValue: "wordpress"},
+				{TagName: "Owner", TagValue: "web"},
+				{TagName: "CostCenter", TagValue: "42"},
+			},
+		},
+		{
+			&[]ghost.InstanceTag{{TagName: "Owner", TagValue: "ops"}},
+			map[string]string{"Owner": "ops"},
+			nil,
+			&[]ghost.InstanceTag{},
+		},
+		{
+			nil,
+			map[string]string{"Owner": "ops"},
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		output := subtractGhostAppInstanceTags(tc.Input, tc.Defaults, tc.Configured)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from subtractGhostAppInstanceTags.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestExpandGhostAppOptionalVolume(t *testing.T) {
+	cases := []struct {
+		Input          []interface{}
+		ExpectedOutput *[]ghost.OptionalVolume
+	}{
+		{
+			[]interface{}{
+				map[string]interface{}{
+					"device_name": "my_device",
+					"volume_type": "gp2",
+					"volume_size": 20,
+					"iops":        3000,
+					"launch_block_device_mappings": false,
+				},
+			},
+			app.EnvironmentInfos.OptionalVolumes,
+		},
+		{
+			nil,
+			&[]ghost.OptionalVolume{},
+		},
+	}
 
 	for _, tc := range cases {
 		output := expandGhostAppOptionalVolumes(tc.Input)
@@ -592,14 +1204,30 @@ func TestExpandGhostAppBuildInfos(t *testing.T) {
 		{
 			[]interface{}{
 				map[string]interface{}{
-					"ssh_username": "admin",
-					"source_ami":   "ami-1",
-					"subnet_id":    "subnet-1",
-					"ami_name":     "",
+					"ssh_username":           "admin",
+					"source_ami":             "ami-1",
+					"source_container_image": "",
+					"subnet_id":              "subnet-1",
+					"ami_name":               "",
 				},
 			},
 			app.BuildInfos,
 		},
+		{
+			[]interface{}{
+				map[string]interface{}{
+					"ssh_username":           "admin",
+					"source_ami":             "",
+					"source_container_image": "debian/9",
+					"subnet_id":              "subnet-1",
+				},
+			},
+			&ghost.BuildInfos{
+				SshUsername:          "admin",
+				SourceContainerImage: "debian/9",
+				SubnetID:             "subnet-1",
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -615,6 +1243,7 @@ func TestExpandGhostAppFeatures(t *testing.T) {
 	cases := []struct {
 		Input          []interface{}
 		ExpectedOutput *[]ghost.Feature
+		ExpectedError  bool
 	}{
 		// Parameters nil
 		{
@@ -633,6 +1262,7 @@ func TestExpandGhostAppFeatures(t *testing.T) {
 				Parameters:  map[string]interface{}{},
 			},
 			},
+			false,
 		},
 		// Valid parameters json
 		{
@@ -657,6 +1287,7 @@ func TestExpandGhostAppFeatures(t *testing.T) {
 					"package_name": []interface{}{"test", "nano"},
 				},
 			}},
+			false,
 		},
 		// Wrong parameters json
 		{
@@ -672,21 +1303,82 @@ func TestExpandGhostAppFeatures(t *testing.T) {
           }`,
 				},
 			},
+			nil,
+			true,
+		},
+		// Parameter blocks
+		{
+			[]interface{}{
+				map[string]interface{}{
+					"name":        "feature",
+					"version":     "1",
+					"provisioner": "ansible",
+					"parameters":  "",
+					"parameter": []interface{}{
+						map[string]interface{}{"name": "package_name", "value": `["test", "nano"]`, "type": "json"},
+						map[string]interface{}{"name": "user", "value": "www-data", "type": "string"},
+						map[string]interface{}{"name": "port", "value": "8080", "type": "number"},
+						map[string]interface{}{"name": "enabled", "value": "true", "type": "bool"},
+					},
+				},
+			},
 			&[]ghost.Feature{{
 				Name:        "feature",
 				Version:     "1",
 				Provisioner: "ansible",
-				Parameters:  nil,
+				Parameters: map[string]interface{}{
+					"package_name": []interface{}{"test", "nano"},
+					"user":         "www-data",
+					"port":         float64(8080),
+					"enabled":      true,
+				},
 			}},
+			false,
+		},
+		// Wrong parameter value
+		{
+			[]interface{}{
+				map[string]interface{}{
+					"name":        "feature",
+					"version":     "1",
+					"provisioner": "ansible",
+					"parameters":  "",
+					"parameter": []interface{}{
+						map[string]interface{}{"name": "port", "value": "http", "type": "number"},
+					},
+				},
+			},
+			nil,
+			true,
+		},
+		// Both parameters and parameter blocks
+		{
+			[]interface{}{
+				map[string]interface{}{
+					"name":        "feature",
+					"version":     "1",
+					"provisioner": "ansible",
+					"parameters":  `{"port": 8080}`,
+					"parameter": []interface{}{
+						map[string]interface{}{"name": "port", "value": "8080", "type": "number"},
+					},
+				},
+			},
+			nil,
+			true,
 		},
 		{
 			nil,
 			&[]ghost.Feature{},
+			false,
 		},
 	}
 
 	for _, tc := range cases {
-		output := expandGhostAppFeatures(tc.Input)
+		output, err := expandGhostAppFeatures(tc.Input)
+		if tc.ExpectedError != (err != nil) {
+			t.Fatalf("Unexpected error from expander: %v", err)
+		}
 		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
 			t.Fatalf("Unexpected output from expander.\nExpected: %#v\nGiven:    %#v",
 				tc.ExpectedOutput, output)
@@ -722,7 +1414,10 @@ func TestExpandGhostAppLifecycleHooks(t *testing.T) {
 	}
 
 	for _, tc := range cases {
-		output := expandGhostAppLifecycleHooks(tc.Input)
+		output, err := expandGhostAppLifecycleHooks(tc.Input)
+		if err != nil {
+			t.Fatalf("Unexpected error from expander: %v", err)
+		}
 		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
 			t.Fatalf("Unexpected output from expander.\nExpected: %#v\nGiven:    %#v",
 				tc.ExpectedOutput, output)
@@ -821,7 +1516,10 @@ func TestExpandGhostAppModules(t *testing.T) {
 	}
 
 	for _, tc := range cases {
-		output := expandGhostAppModules(tc.Input)
+		output, err := expandGhostAppModules(tc.Input)
+		if err != nil {
+			t.Fatalf("Unexpected error from expander: %v", err)
+		}
 		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
 			t.Fatalf("Unexpected output from expander.\nExpected: %#v\nGiven:    %#v",
 				tc.ExpectedOutput, output)
@@ -1063,10 +1761,30 @@ func TestFlattenGhostAppBuildInfos(t *testing.T) {
 			app.BuildInfos,
 			[]interface{}{
 				map[string]interface{}{
-					"ssh_username": "admin",
-					"source_ami":   "ami-1",
-					"subnet_id":    "subnet-1",
-					"ami_name":     "",
+					"ssh_username":           "admin",
+					"source_ami":             "ami-1",
+					"subnet_id":              "subnet-1",
+					"ami_name":               "",
+					"source_container_image": "",
+					"container_image":        "",
+				},
+			},
+		},
+		{
+			&ghost.BuildInfos{
+				SshUsername:          "admin",
+				SubnetID:             "subnet-1",
+				SourceContainerImage: "debian/9",
+				ContainerImage:       "ghost/wordpress/20181002",
+			},
+			[]interface{}{
+				map[string]interface{}{
+					"ssh_username":           "admin",
+					"source_ami":             "",
+					"subnet_id":              "subnet-1",
+					"ami_name":               "",
+					"source_container_image": "debian/9",
+					"container_image":        "ghost/wordpress/20181002",
 				},
 			},
 		},
@@ -1151,7 +1869,10 @@ func TestFlattenGhostAppLifecycleHooks(t *testing.T) {
 	}
 
 	for _, tc := range cases {
-		output := flattenGhostAppLifecycleHooks(tc.Input)
+		output, err := flattenGhostAppLifecycleHooks(tc.Input)
+		if err != nil {
+			t.Fatalf("Unexpected error from flattener: %v", err)
+		}
 		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
 			t.Fatalf("Unexpected output from flattener.\nExpected: %#v\nGiven:    %#v",
 				tc.ExpectedOutput, output)
@@ -1228,24 +1949,29 @@ func TestFlattenGhostAppModules(t *testing.T) {
 			app.Modules,
 			[]interface{}{
 				map[string]interface{}{
-					"name":             "my_module",
-					"git_repo":         "https://github.com/test/test.git",
-					"path":             "/",
-					"scope":            "system",
-					"build_pack":       "#!/usr/bin/env bash",
-					"pre_deploy":       "#!/usr/bin/env bash",
-					"post_deploy":      "",
-					"after_all_deploy": "",
-					"uid":              0,
-					"gid":              0,
-					"last_deployment":  "",
+					"name":                 "my_module",
+					"git_repo":             "https://github.com/test/test.git",
+					"path":                 "/",
+					"scope":                "system",
+					"build_pack":           "#!/usr/bin/env bash",
+					"pre_deploy":           "#!/usr/bin/env bash",
+					"post_deploy":          "",
+					"after_all_deploy":     "",
+					"uid":                  0,
+					"gid":                  0,
+					"last_deployment":      "",
+					"initialized":          false,
+					"needs_initial_deploy": true,
 				},
 			},
 		},
 	}
 
 	for _, tc := range cases {
-		output := flattenGhostAppModules(tc.Input)
+		output, err := flattenGhostAppModules(tc.Input)
+		if err != nil {
+			t.Fatalf("Unexpected error from flattener: %v", err)
+		}
 		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
 			t.Fatalf("Unexpected output from flattener.\nExpected: %#v\nGiven:    %#v",
 				tc.ExpectedOutput, output)
@@ -1336,7 +2062,7 @@ func TestSuppressDiffEnvironmentInfos(t *testing.T) {
 	nonEmptyResourceData := resource.Data(&terraform.InstanceState{
 		ID: "ghost_app.test.id",
 	})
-	flattenGhostApp(nonEmptyResourceData, app)
+	flattenGhostApp(nonEmptyResourceData, app, app)
 
 	cases := []struct {
 		ParameterName  string
@@ -1366,7 +2092,7 @@ func TestSuppressDiffAutoscale(t *testing.T) {
 	nonEmptyResourceData := resource.Data(&terraform.InstanceState{
 		ID: "ghost_app.test.id",
 	})
-	flattenGhostApp(nonEmptyResourceData, app)
+	flattenGhostApp(nonEmptyResourceData, app, app)
 
 	cases := []struct {
 		ParameterName  string
@@ -1397,7 +2123,7 @@ func TestSuppressDiffLifecycleHooks(t *testing.T) {
 	nonEmptyResourceData := resource.Data(&terraform.InstanceState{
 		ID: "ghost_app.test.id",
 	})
-	flattenGhostApp(nonEmptyResourceData, app)
+	flattenGhostApp(nonEmptyResourceData, app, app)
 
 	cases := []struct {
 		ParameterName  string
@@ -1427,7 +2153,7 @@ func TestSuppressDiffSafeDeployment(t *testing.T) {
 	nonEmptyResourceDataWithDefaults := resource.Data(&terraform.InstanceState{
 		ID: "ghost_app.test.id",
 	})
-	flattenGhostApp(nonEmptyResourceDataWithDefaults, app)
+	flattenGhostApp(nonEmptyResourceDataWithDefaults, app, app)
 
 	cases := []struct {
 		ParameterName  string
@@ -1449,3 +2175,2278 @@ func TestSuppressDiffSafeDeployment(t *testing.T) {
 		}
 	}
 }
+
+// Plan time validation Unit Tests
+func TestValidateGhostAppAutoscale(t *testing.T) {
+	cases := []struct {
+		Input *ghost.Autoscale
+		Valid bool
+	}{
+		{&ghost.Autoscale{Min: 1, Max: 3}, true},
+		{&ghost.Autoscale{Min: 3, Max: 3}, true},
+		{&ghost.Autoscale{Min: 0, Max: 0}, true},
+		{&ghost.Autoscale{Min: 2, Max: 0}, false},
+		{&ghost.Autoscale{Min: 4, Max: 3}, false},
+	}
+
+	for _, tc := range cases {
+		errs := validateGhostAppAutoscale(tc.Input)
+		if tc.Valid != (len(errs) == 0) {
+			t.Fatalf("Unexpected output from validateGhostAppAutoscale for %#v: %v", tc.Input, errs)
+		}
+	}
+}
+
+func TestValidateGhostAppSafeDeployment(t *testing.T) {
+	cases := []struct {
+		Input          *ghost.SafeDeployment
+		ExpectedErrors int
+	}{
+		{app.SafeDeployment, 0},
+		{&ghost.SafeDeployment{LoadBalancerType: "alb"}, 0},
+		{&ghost.SafeDeployment{
+			LoadBalancerType: "haproxy",
+			HaBackend:        "backend",
+			ApiPort:          5001,
+			AppTagValue:      "app",
+		}, 0},
+		{&ghost.SafeDeployment{
+			LoadBalancerType: "haproxy",
+			HaBackend:        "backend",
+		}, 2},
+		{&ghost.SafeDeployment{LoadBalancerType: "haproxy"}, 3},
+	}
+
+	for _, tc := range cases {
+		errs := validateGhostAppSafeDeployment(tc.Input)
+		if len(errs) != tc.ExpectedErrors {
+			t.Fatalf("Unexpected output from validateGhostAppSafeDeployment for %#v.\nExpected: %d errors\nGiven:    %v",
+				tc.Input, tc.ExpectedErrors, errs)
+		}
+	}
+}
+
+func TestValidateGhostAppOptionalVolumes(t *testing.T) {
+	cases := []struct {
+		Input          *[]ghost.OptionalVolume
+		ExpectedErrors int
+	}{
+		{&[]ghost.OptionalVolume{}, 0},
+		{&[]ghost.OptionalVolume{
+			{DeviceName: "/dev/xvdb", VolumeType: "io1", Iops: 3000},
+			{DeviceName: "/dev/xvdc", VolumeType: "gp2"},
+		}, 0},
+		{&[]ghost.OptionalVolume{
+			{DeviceName: "/dev/xvdb", VolumeType: "gp2", Iops: 3000},
+		}, 1},
+		{&[]ghost.OptionalVolume{
+			{DeviceName: "/dev/xvdb", VolumeType: "gp2"},
+			{DeviceName: "/dev/xvdb", VolumeType: "st1"},
+		}, 1},
+		{&[]ghost.OptionalVolume{
+			{DeviceName: "/dev/xvdb", VolumeType: "gp2"},
+			{DeviceName: "/dev/xvdb", VolumeType: "st1", Iops: 100},
+		}, 2},
+	}
+
+	for _, tc := range cases {
+		errs := validateGhostAppOptionalVolumes(tc.Input)
+		if len(errs) != tc.ExpectedErrors {
+			t.Fatalf("Unexpected output from validateGhostAppOptionalVolumes for %#v.\nExpected: %d errors\nGiven:    %v",
+				tc.Input, tc.ExpectedErrors, errs)
+		}
+	}
+}
+
+func TestValidateGhostAppModules(t *testing.T) {
+	cases := []struct {
+		Input          *[]ghost.Module
+		ExpectedErrors int
+	}{
+		{app.Modules, 0},
+		{&[]ghost.Module{{Name: "mod1"}, {Name: "mod2"}}, 0},
+		{&[]ghost.Module{{Name: ""}, {Name: ""}}, 0},
+		{&[]ghost.Module{{Name: "mod1"}, {Name: "mod2"}, {Name: "mod1"}}, 1},
+		{&[]ghost.Module{{Name: "mod1"}, {Name: "mod1"}, {Name: "mod1"}}, 2},
+	}
+
+	for _, tc := range cases {
+		errs := validateGhostAppModules(tc.Input)
+		if len(errs) != tc.ExpectedErrors {
+			t.Fatalf("Unexpected output from validateGhostAppModules for %#v.\nExpected: %d errors\nGiven:    %v",
+				tc.Input, tc.ExpectedErrors, errs)
+		}
+	}
+}
+
+func TestValidateGhostAppBlueGreen(t *testing.T) {
+	cases := []struct {
+		Input []interface{}
+		Valid bool
+	}{
+		{nil, true},
+		{[]interface{}{nil}, true},
+		{[]interface{}{
+			map[string]interface{}{
+				"enable_blue_green": true,
+				"color":             "blue",
+			},
+		}, true},
+		{[]interface{}{
+			map[string]interface{}{
+				"enable_blue_green": false,
+				"color":             "",
+			},
+		}, true},
+		{[]interface{}{
+			map[string]interface{}{
+				"enable_blue_green": true,
+				"color":             "",
+			},
+		}, false},
+	}
+
+	for _, tc := range cases {
+		errs := validateGhostAppBlueGreen(tc.Input)
+		if tc.Valid != (len(errs) == 0) {
+			t.Fatalf("Unexpected output from validateGhostAppBlueGreen for %#v: %v", tc.Input, errs)
+		}
+	}
+}
+
+func testGhostAppRawConfig(t *testing.T, overrides map[string]interface{}) *terraform.ResourceConfig {
+	values := map[string]interface{}{
+		"name":   "app_name",
+		"env":    "test",
+		"role":   "web",
+		"vpc_id": "vpc-123456",
+		"build_infos": []interface{}{
+			map[string]interface{}{
+				"subnet_id":  "subnet-1",
+				"source_ami": "ami-1",
+			},
+		},
+		"environment_infos": []interface{}{
+			map[string]interface{}{},
+		},
+		"modules": []interface{}{
+			map[string]interface{}{
+				"name":     "my_module",
+				"git_repo": "https://github.com/test/test.git",
+				"path":     "/var/www",
+				"scope":    "code",
+			},
+		},
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(values, k)
+			continue
+		}
+		values[k] = v
+	}
+
+	raw, err := config.NewRawConfig(values)
+	if err != nil {
+		t.Fatalf("error building config: %v", err)
+	}
+
+	return terraform.NewResourceConfig(raw)
+}
+
+func TestResourceGhostAppCustomizeDiff(t *testing.T) {
+	cases := []struct {
+		Overrides map[string]interface{}
+		Valid     bool
+	}{
+		{nil, true},
+		{map[string]interface{}{
+			"autoscale": []interface{}{
+				map[string]interface{}{"min": 3, "max": 2},
+			},
+		}, false},
+		{map[string]interface{}{
+			"safe_deployment": []interface{}{
+				map[string]interface{}{"load_balancer_type": "haproxy"},
+			},
+		}, false},
+		{map[string]interface{}{
+			"environment_infos": []interface{}{
+				map[string]interface{}{
+					"optional_volumes": []interface{}{
+						map[string]interface{}{
+							"device_name": "/dev/xvdb",
+							"volume_type": "gp2",
+							"volume_size": 20,
+							"iops":        3000,
+						},
+					},
+				},
+			},
+		}, false},
+		{map[string]interface{}{
+			"blue_green": []interface{}{
+				map[string]interface{}{"enable_blue_green": true},
+			},
+		}, false},
+		{map[string]interface{}{
+			"environment_variables_map": map[string]interface{}{"myvar": "myvalue"},
+			"sensitive_environment_variables": []interface{}{
+				map[string]interface{}{"key": "myvar", "value": "secret"},
+			},
+		}, false},
+		{map[string]interface{}{
+			"build_infos": []interface{}{
+				map[string]interface{}{
+					"subnet_id":              "subnet-1",
+					"source_container_image": "debian/9",
+				},
+			},
+		}, true},
+		{map[string]interface{}{
+			"build_infos": []interface{}{
+				map[string]interface{}{
+					"subnet_id":              "subnet-1",
+					"source_ami":             "ami-1",
+					"source_container_image": "debian/9",
+				},
+			},
+		}, false},
+		{map[string]interface{}{
+			"build_infos": []interface{}{
+				map[string]interface{}{"subnet_id": "subnet-1"},
+			},
+		}, false},
+		{map[string]interface{}{
+			"build_infos": []interface{}{
+				map[string]interface{}{"subnet_id": "subnet-1", "source_ami": config.UnknownVariableValue},
+			},
+		}, true},
+		{map[string]interface{}{
+			"render_templates": true,
+			"modules": []interface{}{
+				map[string]interface{}{
+					"name":        "my_module",
+					"git_repo":    "https://github.com/test/test.git",
+					"path":        "/var/www",
+					"scope":       "code",
+					"post_deploy": "echo {{ .App.Name }} {{ .Module.Path }}",
+				},
+			},
+		}, true},
+		{map[string]interface{}{
+			"render_templates": true,
+			"lifecycle_hooks": []interface{}{
+				map[string]interface{}{"pre_bootstrap": "echo {{ .Vars.UNDEFINED }}"},
+			},
+		}, false},
+		{map[string]interface{}{
+			"autoscale": []interface{}{
+				map[string]interface{}{"min": 2, "max": 0},
+			},
+		}, false},
+		{map[string]interface{}{
+			"autoscale": []interface{}{
+				map[string]interface{}{"min": 2, "max": config.UnknownVariableValue},
+			},
+		}, true},
+		{map[string]interface{}{
+			"features": []interface{}{
+				map[string]interface{}{
+					"name": "php5",
+					"parameter": []interface{}{
+						map[string]interface{}{"name": "port", "value": "", "type": "number"},
+					},
+				},
+			},
+		}, false},
+		{map[string]interface{}{
+			"features": []interface{}{
+				map[string]interface{}{
+					"name": "php5",
+					"parameter": []interface{}{
+						map[string]interface{}{"name": "port", "value": config.UnknownVariableValue, "type": "number"},
+					},
+				},
+			},
+		}, true},
+		{map[string]interface{}{
+			"vpc_id": nil,
+		}, false},
+		{map[string]interface{}{
+			"vpc_id": config.UnknownVariableValue,
+		}, true},
+		{map[string]interface{}{
+			"modules": []interface{}{},
+		}, true},
+		{map[string]interface{}{
+			"modules": nil,
+		}, false},
+		{map[string]interface{}{
+			"modules": nil,
+			"keyed_modules": []interface{}{
+				map[string]interface{}{
+					"name":     "my_module",
+					"git_repo": "https://github.com/test/test.git",
+					"path":     "/var/www",
+					"scope":    "code",
+					"order":    1,
+				},
+				map[string]interface{}{
+					"name":     "my_module",
+					"git_repo": "https://github.com/test/other.git",
+					"path":     "/var/www",
+					"scope":    "code",
+					"order":    2,
+				},
+			},
+		}, false},
+	}
+
+	for _, tc := range cases {
+		_, err := resourceGhostApp().Diff(nil, testGhostAppRawConfig(t, tc.Overrides), nil)
+		if tc.Valid != (err == nil) {
+			t.Fatalf("Unexpected output from CustomizeDiff for %#v: %v", tc.Overrides, err)
+		}
+	}
+}
+
+func TestFlattenGhostAppSensitiveEnvironmentVariables(t *testing.T) {
+	cases := []struct {
+		Input          *[]ghost.EnvironmentVariable
+		ExpectedOutput []interface{}
+	}{
+		{
+			app.EnvironmentVariables,
+			[]interface{}{
+				map[string]interface{}{
+					"key":   "env_var_key",
+					"value": HashSum("salt", "env_var_value"),
+				},
+			},
+		},
+		{
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		output := flattenGhostAppSensitiveEnvironmentVariables(tc.Input, "salt")
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from flattener.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestSplitGhostAppEnvironmentVariables(t *testing.T) {
+	cases := []struct {
+		Input             *[]ghost.EnvironmentVariable
+		SensitiveKeys     []string
+		ExpectedRegular   *[]ghost.EnvironmentVariable
+		ExpectedSensitive *[]ghost.EnvironmentVariable
+	}{
+		{
+			&[]ghost.EnvironmentVariable{
+				{Key: "a", Value: "1"},
+				{Key: "password", Value: "secret"},
+				{Key: "b", Value: "2"},
+				{Key: "token", Value: "secret2"},
+			},
+			[]string{"token", "password", "missing"},
+			&[]ghost.EnvironmentVariable{
+				{Key: "a", Value: "1"},
+				{Key: "b", Value: "2"},
+			},
+			&[]ghost.EnvironmentVariable{
+				{Key: "token", Value: "secret2"},
+				{Key: "password", Value: "secret"},
+			},
+		},
+		{
+			app.EnvironmentVariables,
+			[]string{},
+			app.EnvironmentVariables,
+			&[]ghost.EnvironmentVariable{},
+		},
+		{
+			nil,
+			[]string{"token"},
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		regular, sensitive := splitGhostAppEnvironmentVariables(tc.Input, tc.SensitiveKeys)
+		if !reflect.DeepEqual(regular, tc.ExpectedRegular) || !reflect.DeepEqual(sensitive, tc.ExpectedSensitive) {
+			t.Fatalf("Unexpected output from splitGhostAppEnvironmentVariables.\nExpected: %#v %#v\nGiven:    %#v %#v",
+				tc.ExpectedRegular, tc.ExpectedSensitive, regular, sensitive)
+		}
+	}
+}
+
+func TestResolveGhostAppEnvironmentVariables(t *testing.T) {
+	current := &[]ghost.EnvironmentVariable{
+		{Key: "a", Value: "1"},
+		{Key: "password", Value: "secret"},
+	}
+
+	cases := []struct {
+		Input          *[]ghost.EnvironmentVariable
+		ExpectedOutput *[]ghost.EnvironmentVariable
+		Valid          bool
+	}{
+		{
+			&[]ghost.EnvironmentVariable{
+				{Key: "a", Value: "2"},
+				{Key: "password", Value: HashSum("salt", "secret")},
+			},
+			&[]ghost.EnvironmentVariable{
+				{Key: "a", Value: "2"},
+				{Key: "password", Value: "secret"},
+			},
+			true,
+		},
+		{
+			&[]ghost.EnvironmentVariable{
+				{Key: "password", Value: "newsecret"},
+			},
+			&[]ghost.EnvironmentVariable{
+				{Key: "password", Value: "newsecret"},
+			},
+			true,
+		},
+		{
+			&[]ghost.EnvironmentVariable{
+				{Key: "password", Value: HashSum("salt", "oldsecret")},
+			},
+			nil,
+			false,
+		},
+		{
+			&[]ghost.EnvironmentVariable{
+				{Key: "token", Value: HashSum("salt", "secret")},
+			},
+			nil,
+			false,
+		},
+		{
+			&[]ghost.EnvironmentVariable{
+				{Key: "password", Value: HashSum("othersalt", "secret")},
+			},
+			nil,
+			false,
+		},
+		{
+			&[]ghost.EnvironmentVariable{
+				{Key: "password", Value: "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"},
+			},
+			&[]ghost.EnvironmentVariable{
+				{Key: "password", Value: "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"},
+			},
+			true,
+		},
+		{
+			&[]ghost.EnvironmentVariable{
+				{Key: "image", Value: "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"},
+				{Key: "a", Value: HashSum("salt", "secret")},
+			},
+			&[]ghost.EnvironmentVariable{
+				{Key: "image", Value: "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"},
+				{Key: "a", Value: HashSum("salt", "secret")},
+			},
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		err := resolveGhostAppEnvironmentVariables(tc.Input, current, []string{"password", "token"}, "salt")
+		if tc.Valid != (err == nil) {
+			t.Fatalf("Unexpected output from resolveGhostAppEnvironmentVariables: %v", err)
+		}
+		if tc.Valid && !reflect.DeepEqual(tc.Input, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from resolveGhostAppEnvironmentVariables.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, tc.Input)
+		}
+	}
+}
+
+func TestSuppressDiffHashedValue(t *testing.T) {
+	suppressFunc := suppressDiffHashedValue()
+	d := schema.TestResourceDataRaw(t, resourceGhostApp().Schema, map[string]interface{}{})
+	d.Set("hash_salt", "salt")
+
+	cases := []struct {
+		ParameterName  string
+		OldValue       string
+		NewValue       string
+		ExpectedOutput bool
+		ResourceData   *schema.ResourceData
+	}{
+		{"sensitive_environment_variables.0.value", HashSum("salt", "secret"), "secret", true, d},
+		{"sensitive_environment_variables.0.value", HashSum("salt", "secret"), "newsecret", false, d},
+		{"sensitive_environment_variables.0.value", HashSum("othersalt", "secret"), "secret", false, d},
+		{"sensitive_environment_variables.0.value",
+			"sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", "secret", false, d},
+		{"sensitive_environment_variables.0.value", "", "secret", false, d},
+	}
+
+	for _, tc := range cases {
+		output := suppressFunc(tc.ParameterName, tc.OldValue, tc.NewValue, tc.ResourceData)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from SuppressDiffHashedValue.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestExpandGhostAppEnvironmentVariablesMap(t *testing.T) {
+	cases := []struct {
+		Input          map[string]interface{}
+		ExpectedOutput *[]ghost.EnvironmentVariable
+	}{
+		{
+			map[string]interface{}{
+				"b_key":       "b",
+				"env_var_key": "env_var_value",
+				"a_key":       "a",
+			},
+			&[]ghost.EnvironmentVariable{
+				{Key: "a_key", Value: "a"},
+				{Key: "b_key", Value: "b"},
+				{Key: "env_var_key", Value: "env_var_value"},
+			},
+		},
+		{
+			nil,
+			&[]ghost.EnvironmentVariable{},
+		},
+	}
+
+	for _, tc := range cases {
+		output := expandGhostAppEnvironmentVariablesMap(tc.Input)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from expander.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestFlattenGhostAppEnvironmentVariablesMap(t *testing.T) {
+	cases := []struct {
+		Input          *[]ghost.EnvironmentVariable
+		ExpectedOutput map[string]interface{}
+	}{
+		{
+			app.EnvironmentVariables,
+			map[string]interface{}{
+				"env_var_key": "env_var_value",
+			},
+		},
+		{
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		output := flattenGhostAppEnvironmentVariablesMap(tc.Input)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from flattener.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestValidateGhostAppEnvironmentVariables(t *testing.T) {
+	cases := []struct {
+		Attribute      string
+		Input          *[]ghost.EnvironmentVariable
+		Sensitive      *[]ghost.EnvironmentVariable
+		ExpectedErrors int
+	}{
+		{"environment_variables", app.EnvironmentVariables, &[]ghost.EnvironmentVariable{}, 0},
+		{"environment_variables", &[]ghost.EnvironmentVariable{
+			{Key: "a"}, {Key: "b"},
+		}, &[]ghost.EnvironmentVariable{{Key: "c"}}, 0},
+		{"environment_variables", &[]ghost.EnvironmentVariable{
+			{Key: "a"}, {Key: "b"}, {Key: "a"},
+		}, &[]ghost.EnvironmentVariable{}, 1},
+		{"environment_variables", &[]ghost.EnvironmentVariable{
+			{Key: "a"}, {Key: "b"},
+		}, &[]ghost.EnvironmentVariable{{Key: "b"}}, 1},
+		{"environment_variables_map", &[]ghost.EnvironmentVariable{
+			{Key: "a"}, {Key: "b"},
+		}, &[]ghost.EnvironmentVariable{{Key: "a"}, {Key: "b"}}, 2},
+	}
+
+	for _, tc := range cases {
+		errs := validateGhostAppEnvironmentVariables(tc.Attribute, tc.Input, tc.Sensitive)
+		if len(errs) != tc.ExpectedErrors {
+			t.Fatalf("Unexpected output from validateGhostAppEnvironmentVariables for %#v.\nExpected: %d errors\nGiven:    %v",
+				tc.Input, tc.ExpectedErrors, errs)
+		}
+	}
+}
+
+func TestValidateGhostAppEnvironmentVariablesMap(t *testing.T) {
+	cases := []struct {
+		Input map[string]interface{}
+		Valid bool
+	}{
+		{map[string]interface{}{"MY_VAR": "1", "_other": "2"}, true},
+		{map[string]interface{}{"MY-VAR": "1"}, false},
+		{map[string]interface{}{"1VAR": "1"}, false},
+	}
+
+	for _, tc := range cases {
+		_, errs := validateGhostAppEnvironmentVariablesMap(tc.Input, "environment_variables_map")
+		if tc.Valid != (len(errs) == 0) {
+			t.Fatalf("Unexpected output from validateGhostAppEnvironmentVariablesMap for %#v: %v", tc.Input, errs)
+		}
+	}
+}
+
+func TestExpandGhostAppKeyedModules(t *testing.T) {
+	module := func(name string, order int) map[string]interface{} {
+		return map[string]interface{}{
+			"name":             name,
+			"order":            order,
+			"git_repo":         "https://github.com/test/test.git",
+			"path":             "/",
+			"scope":            "system",
+			"build_pack":       "",
+			"pre_deploy":       "",
+			"post_deploy":      "",
+			"after_all_deploy": "",
+			"uid":              0,
+			"gid":              0,
+			"last_deployment":  "",
+		}
+	}
+
+	cases := []struct {
+		Input         []interface{}
+		ExpectedNames []string
+	}{
+		{
+			[]interface{}{module("c", 30), module("a", 10), module("b", 20)},
+			[]string{"a", "b", "c"},
+		},
+		{
+			[]interface{}{module("b", 1), module("a", 1), module("c", 0)},
+			[]string{"c", "a", "b"},
+		},
+		{
+			nil,
+			[]string{},
+		},
+	}
+
+	for _, tc := range cases {
+		output, err := expandGhostAppKeyedModules(tc.Input)
+		if err != nil {
+			t.Fatalf("Unexpected error from expander: %v", err)
+		}
+		names := []string{}
+		for _, module := range *output {
+			names = append(names, module.Name)
+		}
+		if !reflect.DeepEqual(names, tc.ExpectedNames) {
+			t.Fatalf("Unexpected output from expander.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedNames, names)
+		}
+	}
+}
+
+func TestFlattenGhostAppKeyedModules(t *testing.T) {
+	modules := &[]ghost.Module{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+
+	cases := []struct {
+		Orders         map[string]int
+		ExpectedOrders []int
+	}{
+		{map[string]int{"a": 10, "b": 20, "c": 30}, []int{10, 20, 30}},
+		{map[string]int{"a": 10, "c": 30}, []int{10, 11, 30}},
+		{map[string]int{"a": 10, "b": 5, "c": 30}, []int{10, 11, 30}},
+		{map[string]int{}, []int{0, 1, 2}},
+	}
+
+	for _, tc := range cases {
+		output, err := flattenGhostAppKeyedModules(modules, tc.Orders)
+		if err != nil {
+			t.Fatalf("Unexpected error from flattener: %v", err)
+		}
+		orders := []int{}
+		for _, module := range output {
+			orders = append(orders, module.(map[string]interface{})["order"].(int))
+		}
+		if !reflect.DeepEqual(orders, tc.ExpectedOrders) {
+			t.Fatalf("Unexpected output from flattener.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOrders, orders)
+		}
+	}
+}
+
+func TestHashGhostAppKeyedModule(t *testing.T) {
+	a := map[string]interface{}{"name": "module", "order": 1, "post_deploy": "echo 1"}
+	b := map[string]interface{}{"name": "module", "order": 1, "post_deploy": "echo 2"}
+	c := map[string]interface{}{"name": "other_module", "order": 1, "post_deploy": "echo 1"}
+	d := map[string]interface{}{"name": "module", "order": 2, "post_deploy": "echo 1"}
+
+	if hashGhostAppKeyedModule(a) != hashGhostAppKeyedModule(b) {
+		t.Fatalf("Modules with the same name and order should have the same hash")
+	}
+	if hashGhostAppKeyedModule(a) == hashGhostAppKeyedModule(c) {
+		t.Fatalf("Modules with different names should have different hashes")
+	}
+	if hashGhostAppKeyedModule(a) == hashGhostAppKeyedModule(d) {
+		t.Fatalf("Modules with different orders should have different hashes")
+	}
+}
+
+func TestValidateGhostAppKeyedModules(t *testing.T) {
+	cases := []struct {
+		Input          []interface{}
+		ExpectedErrors int
+	}{
+		{[]interface{}{
+			map[string]interface{}{"name": "a", "order": 1},
+			map[string]interface{}{"name": "b", "order": 2},
+		}, 0},
+		{[]interface{}{
+			map[string]interface{}{"name": "a", "order": 1},
+			map[string]interface{}{"name": "b", "order": 1},
+			map[string]interface{}{"name": "c", "order": 1},
+		}, 2},
+		{[]interface{}{
+			map[string]interface{}{"name": "a", "order": 1},
+			map[string]interface{}{"name": "a", "order": 2},
+		}, 1},
+	}
+
+	for _, tc := range cases {
+		errs := validateGhostAppKeyedModules(tc.Input)
+		if len(errs) != tc.ExpectedErrors {
+			t.Fatalf("Unexpected output from validateGhostAppKeyedModules for %#v.\nExpected: %d errors\nGiven:    %v",
+				tc.Input, tc.ExpectedErrors, errs)
+		}
+	}
+}
+
+func TestFlattenGhostAppFeaturesParameterBlocks(t *testing.T) {
+	features := &[]ghost.Feature{{
+		Name:        "feature",
+		Version:     "1",
+		Provisioner: "ansible",
+		Parameters: map[string]interface{}{
+			"package_name": []interface{}{"test", "nano"},
+			"user":         "www-data",
+			"port":         float64(8080),
+			"enabled":      true,
+		},
+	}}
+
+	cases := []struct {
+		Configured     []interface{}
+		ExpectedOutput []interface{}
+	}{
+		// Feature configured with parameters json
+		{
+			[]interface{}{
+				map[string]interface{}{
+					"parameters": `{}`,
+					"parameter":  []interface{}{},
+				},
+			},
+			flattenGhostAppFeatures(features),
+		},
+		// Feature configured with parameter blocks
+		{
+			[]interface{}{
+				map[string]interface{}{
+					"parameters": "",
+					"parameter": []interface{}{
+						map[string]interface{}{"name": "user", "value": "www-data", "type": "string"},
+						map[string]interface{}{"name": "port", "value": "8080", "type": "number"},
+					},
+				},
+			},
+			[]interface{}{
+				map[string]interface{}{
+					"name":        "feature",
+					"version":     "1",
+					"provisioner": "ansible",
+					"parameters":  "",
+					"parameter": []interface{}{
+						map[string]interface{}{"name": "user", "value": "www-data", "type": "string"},
+						map[string]interface{}{"name": "port", "value": "8080", "type": "number"},
+						map[string]interface{}{"name": "enabled", "value": "true", "type": "bool"},
+						map[string]interface{}{"name": "package_name", "value": `["test","nano"]`, "type": "json"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		output := flattenGhostAppFeaturesParameterBlocks(flattenGhostAppFeatures(features), tc.Configured)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from flattener.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestValidateGhostAppFeatures(t *testing.T) {
+	known := func(key string) bool { return true }
+	hostUnknown := func(key string) bool { return key != "features.0.parameter.1.value" }
+
+	cases := []struct {
+		Input          []interface{}
+		Known          func(key string) bool
+		ExpectedErrors int
+	}{
+		{[]interface{}{
+			map[string]interface{}{
+				"parameters": `{"port": 8080}`,
+				"parameter":  []interface{}{},
+			},
+		}, known, 0},
+		{[]interface{}{
+			map[string]interface{}{
+				"parameters": "",
+				"parameter": []interface{}{
+					map[string]interface{}{"name": "port", "value": "8080", "type": "number"},
+					map[string]interface{}{"name": "host", "value": "", "type": "json"},
+				},
+			},
+		}, hostUnknown, 0},
+		{[]interface{}{
+			map[string]interface{}{
+				"parameters": "",
+				"parameter": []interface{}{
+					map[string]interface{}{"name": "port", "value": "8080", "type": "number"},
+					map[string]interface{}{"name": "host", "value": "", "type": "json"},
+				},
+			},
+		}, known, 1},
+		{[]interface{}{
+			map[string]interface{}{
+				"parameters": `{"port": 8080}`,
+				"parameter": []interface{}{
+					map[string]interface{}{"name": "port", "value": "8080", "type": "number"},
+				},
+			},
+		}, known, 1},
+		{[]interface{}{
+			map[string]interface{}{
+				"parameters": "",
+				"parameter": []interface{}{
+					map[string]interface{}{"name": "port", "value": "http", "type": "number"},
+					map[string]interface{}{"name": "port", "value": "8080", "type": "number"},
+				},
+			},
+		}, known, 2},
+	}
+
+	for _, tc := range cases {
+		errs := validateGhostAppFeatures(tc.Input, tc.Known)
+		if len(errs) != tc.ExpectedErrors {
+			t.Fatalf("Unexpected output from validateGhostAppFeatures for %#v.\nExpected: %d errors\nGiven:    %v",
+				tc.Input, tc.ExpectedErrors, errs)
+		}
+	}
+}
+
+func TestSuppressDiffFeatureParameterValue(t *testing.T) {
+	suppressFunc := suppressDiffFeatureParameterValue()
+
+	resourceData := schema.TestResourceDataRaw(t, resourceGhostApp().Schema, map[string]interface{}{
+		"features": []interface{}{
+			map[string]interface{}{
+				"name":        "feature",
+				"provisioner": "ansible",
+				"parameter": []interface{}{
+					map[string]interface{}{"name": "user", "value": "www-data"},
+					map[string]interface{}{"name": "port", "value": "8080", "type": "number"},
+					map[string]interface{}{"name": "packages", "value": `["nano"]`, "type": "json"},
+				},
+			},
+		},
+	})
+
+	cases := []struct {
+		ParameterName  string
+		OldValue       string
+		NewValue       string
+		ExpectedOutput bool
+	}{
+		{"features.0.parameter.0.value", "www-data", "www-data ", false},
+		{"features.0.parameter.1.value", "8080", "8080.0", true},
+		{"features.0.parameter.1.value", "8080", "8081", false},
+		{"features.0.parameter.2.value", `["nano"]`, `[ "nano" ]`, true},
+		{"features.0.parameter.2.value", `["nano"]`, `["vim"]`, false},
+	}
+
+	for _, tc := range cases {
+		output := suppressFunc(tc.ParameterName, tc.OldValue, tc.NewValue, resourceData)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from SuppressDiffFeatureParameterValue for %s.\nExpected: %#v\nGiven:    %#v",
+				tc.ParameterName, tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestExpandGhostAppScript(t *testing.T) {
+	file, err := ioutil.TempFile("", "ghost_app_script")
+	if err != nil {
+		t.Fatalf("Unable to create script file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("#!/bin/bash\necho file\n")
+	file.Close()
+
+	cases := []struct {
+		Input          map[string]interface{}
+		ExpectedOutput string
+		Valid          bool
+	}{
+		{
+			map[string]interface{}{"pre_deploy": "echo inline", "pre_deploy_file": ""},
+			StrToB64("echo inline"),
+			true,
+		},
+		{
+			map[string]interface{}{"pre_deploy": "", "pre_deploy_file": file.Name()},
+			StrToB64("#!/bin/bash\necho file\n"),
+			true,
+		},
+		{
+			map[string]interface{}{"pre_deploy": "", "pre_deploy_file": HashSum("salt", "echo")},
+			StrToB64(HashSum("salt", "echo")),
+			true,
+		},
+		{
+			map[string]interface{}{"pre_deploy": "", "pre_deploy_file": file.Name() + ".missing"},
+			"",
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		output, err := expandGhostAppScript(tc.Input, "pre_deploy")
+		if tc.Valid != (err == nil) {
+			t.Fatalf("Unexpected output from expandGhostAppScript: %v", err)
+		}
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from expandGhostAppScript.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestFlattenGhostAppModulesScriptFiles(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{
+			"name":             "wordpress",
+			"build_pack":       "",
+			"pre_deploy":       "#!/bin/bash\necho pre\n",
+			"post_deploy":      "echo post",
+			"after_all_deploy": "",
+		},
+	}
+	configured := []interface{}{
+		map[string]interface{}{
+			"name":            "wordpress",
+			"pre_deploy_file": "pre_deploy.sh",
+		},
+	}
+	expected := []interface{}{
+		map[string]interface{}{
+			"name":                  "wordpress",
+			"build_pack":            "",
+			"build_pack_file":       "",
+			"pre_deploy":            "",
+			"pre_deploy_file":       HashSum("salt", "#!/bin/bash\necho pre\n"),
+			"post_deploy":           "echo post",
+			"post_deploy_file":      "",
+			"after_all_deploy":      "",
+			"after_all_deploy_file": "",
+			"file_previews": map[string]interface{}{
+				"pre_deploy": "#!/bin/bash...",
+			},
+		},
+	}
+
+	output := flattenGhostAppModulesScriptFiles(input, configured, "salt")
+	if !reflect.DeepEqual(output, expected) {
+		t.Fatalf("Unexpected output from flattenGhostAppModulesScriptFiles.\nExpected: %#v\nGiven:    %#v",
+			expected, output)
+	}
+}
+
+func TestResolveGhostAppHashedValues(t *testing.T) {
+	current := ghost.App{
+		EnvironmentVariables: &[]ghost.EnvironmentVariable{},
+		Modules: &[]ghost.Module{
+			{Name: "wordpress", PreDeploy: StrToB64("echo pre")},
+		},
+		LifecycleHooks: &ghost.LifecycleHooks{PostBootstrap: StrToB64("echo hook")},
+	}
+
+	cases := []struct {
+		Input          ghost.App
+		ExpectedOutput ghost.App
+		Valid          bool
+	}{
+		{
+			ghost.App{
+				EnvironmentVariables: &[]ghost.EnvironmentVariable{},
+				Modules: &[]ghost.Module{
+					{Name: "wordpress", PreDeploy: StrToB64(HashSum("salt", "echo pre"))},
+				},
+				LifecycleHooks: &ghost.LifecycleHooks{PostBootstrap: StrToB64(HashSum("salt", "echo hook"))},
+			},
+			ghost.App{
+				EnvironmentVariables: &[]ghost.EnvironmentVariable{},
+				Modules: &[]ghost.Module{
+					{Name: "wordpress", PreDeploy: StrToB64("echo pre")},
+				},
+				LifecycleHooks: &ghost.LifecycleHooks{PostBootstrap: StrToB64("echo hook")},
+			},
+			true,
+		},
+		{
+			ghost.App{
+				EnvironmentVariables: &[]ghost.EnvironmentVariable{},
+				Modules: &[]ghost.Module{
+					{Name: "wordpress", PreDeploy: StrToB64(HashSum("salt", "echo old"))},
+				},
+				LifecycleHooks: &ghost.LifecycleHooks{},
+			},
+			ghost.App{},
+			false,
+		},
+		{
+			ghost.App{
+				EnvironmentVariables: &[]ghost.EnvironmentVariable{},
+				Modules: &[]ghost.Module{
+					{Name: "symfony", PreDeploy: StrToB64(HashSum("salt", "echo pre"))},
+				},
+				LifecycleHooks: &ghost.LifecycleHooks{},
+			},
+			ghost.App{},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		if !ghostAppHasHashedValues(tc.Input, nil) {
+			t.Fatalf("Unexpected output from ghostAppHasHashedValues: %#v", tc.Input)
+		}
+		err := resolveGhostAppHashedValues(&tc.Input, current, nil, "salt")
+		if tc.Valid != (err == nil) {
+			t.Fatalf("Unexpected output from resolveGhostAppHashedValues: %v", err)
+		}
+		if tc.Valid && !reflect.DeepEqual(tc.Input, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from resolveGhostAppHashedValues.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, tc.Input)
+		}
+	}
+}
+
+func TestValidateGhostAppScripts(t *testing.T) {
+	cases := []struct {
+		Modules        []interface{}
+		LifecycleHooks []interface{}
+		ErrorsCount    int
+	}{
+		{
+			[]interface{}{
+				map[string]interface{}{"name": "wordpress", "pre_deploy": "echo", "post_deploy_file": "post.sh"},
+			},
+			[]interface{}{
+				map[string]interface{}{"pre_bootstrap_file": "bootstrap.sh"},
+			},
+			0,
+		},
+		{
+			[]interface{}{
+				map[string]interface{}{"name": "wordpress", "pre_deploy": "echo", "pre_deploy_file": "pre.sh"},
+			},
+			[]interface{}{
+				map[string]interface{}{"pre_bootstrap": "echo", "pre_bootstrap_file": "bootstrap.sh"},
+			},
+			2,
+		},
+	}
+
+	for _, tc := range cases {
+		errs := validateGhostAppScripts(tc.Modules, tc.LifecycleHooks)
+		if len(errs) != tc.ErrorsCount {
+			t.Fatalf("Unexpected output from validateGhostAppScripts: %v", errs)
+		}
+	}
+}
+
+func TestGhostAppScriptsDiff(t *testing.T) {
+	current := ghost.App{
+		Modules: &[]ghost.Module{
+			{Name: "wordpress", PreDeploy: StrToB64("echo pre\n")},
+		},
+	}
+	modules := &[]ghost.Module{
+		{Name: "wordpress", PreDeploy: StrToB64("echo new\n"), PostDeploy: StrToB64(HashSum("salt", "echo post\n"))},
+	}
+	lifecycleHooks := &ghost.LifecycleHooks{PreBootstrap: StrToB64("echo hook\n")}
+
+	expected := "--- modules.wordpress.pre_deploy\n+++ modules.wordpress.pre_deploy\n" +
+		"@@ -1,1 +1,1 @@\n-echo pre\n+echo new\n" +
+		"--- lifecycle_hooks.pre_bootstrap\n+++ lifecycle_hooks.pre_bootstrap\n" +
+		"@@ -0,0 +1,1 @@\n+echo hook\n"
+
+	output, err := ghostAppScriptsDiff(modules, lifecycleHooks, current)
+	if err != nil {
+		t.Fatalf("Unexpected error from ghostAppScriptsDiff: %v", err)
+	}
+	if !reflect.DeepEqual(output, expected) {
+		t.Fatalf("Unexpected output from ghostAppScriptsDiff.\nExpected: %#v\nGiven:    %#v",
+			expected, output)
+	}
+}
+
+// Scripts are diffed with the prior state, without reading the app from Ghost
+// unless a script is only known by its hash
+func TestGhostAppPriorScriptsDiff(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ghost")
+	defer os.RemoveAll(dir)
+	postDeployFile := filepath.Join(dir, "post_deploy.sh")
+	ioutil.WriteFile(postDeployFile, []byte("echo new post\n"), 0644)
+
+	modules := func(preDeploy string, postDeployFile string) []interface{} {
+		return []interface{}{
+			map[string]interface{}{
+				"name":             "my_module",
+				"git_repo":         "https://github.com/test/test.git",
+				"path":             "/var/www",
+				"scope":            "code",
+				"pre_deploy":       preDeploy,
+				"post_deploy_file": postDeployFile,
+			},
+		}
+	}
+	prior := schema.TestResourceDataRaw(t, resourceGhostApp().Schema, map[string]interface{}{
+		"name":   "app_name",
+		"env":    "test",
+		"role":   "web",
+		"vpc_id": "vpc-123456",
+		"build_infos": []interface{}{
+			map[string]interface{}{"subnet_id": "subnet-1", "source_ami": "ami-1"},
+		},
+		"environment_infos": []interface{}{
+			map[string]interface{}{},
+		},
+		"modules": modules("echo pre\n", HashSum("salt", "echo post\n")),
+	})
+	prior.SetId("5b9f9d2a4f3e4a0001b7d8e1")
+	prior.Set("hash_salt", "salt")
+
+	// Ghost can't be reached, so the script set from a file is left out
+	client := &GhostClient{Endpoint: "http://127.0.0.1:1", Auth: BasicAuth{Username: "ghost", Password: "ghost"}}
+	config := testGhostAppRawConfig(t, map[string]interface{}{"modules": modules("echo new\n", postDeployFile)})
+
+	diff, err := resourceGhostApp().Diff(prior.State(), config, client)
+	if err != nil {
+		t.Fatalf("Unexpected error from Diff: %v", err)
+	}
+	expected := "--- modules.my_module.pre_deploy\n+++ modules.my_module.pre_deploy\n" +
+		"@@ -1,1 +1,1 @@\n-echo pre\n+echo new\n"
+	if attr, ok := diff.Attributes["scripts_diff"]; !ok || attr.New != expected {
+		t.Fatalf("Unexpected scripts_diff from Diff.\nExpected: %#v\nGiven:    %#v", expected, attr)
+	}
+}
+
+func TestFlattenGhostAppInvalidScripts(t *testing.T) {
+	modules := &[]ghost.Module{
+		{Name: "wordpress", PreDeploy: StrToB64("echo")},
+		{Name: "symfony", PostDeploy: "not base64"},
+	}
+	if _, err := flattenGhostAppModules(modules); err == nil ||
+		!strings.HasPrefix(err.Error(), "1.post_deploy (module symfony): ") {
+		t.Fatalf("Unexpected error from flattenGhostAppModules: %v", err)
+	}
+
+	lifecycleHooks := &ghost.LifecycleHooks{PreBootstrap: "not base64"}
+	if _, err := flattenGhostAppLifecycleHooks(lifecycleHooks); err == nil ||
+		!strings.HasPrefix(err.Error(), "0.pre_bootstrap: ") {
+		t.Fatalf("Unexpected error from flattenGhostAppLifecycleHooks: %v", err)
+	}
+
+	// Nothing is set in state when a script can't be decoded
+	d := resourceGhostApp().TestResourceData()
+	d.Set("name", "app")
+	app := ghost.App{Name: "other", Modules: modules, LifecycleHooks: &ghost.LifecycleHooks{}}
+	err := flattenGhostApp(d, app, app)
+	if err == nil || !strings.HasPrefix(err.Error(), "modules.1.post_deploy") {
+		t.Fatalf("Unexpected error from flattenGhostApp: %v", err)
+	}
+	if d.Get("name").(string) != "app" {
+		t.Fatalf("Unexpected name set by flattenGhostApp: %s", d.Get("name"))
+	}
+}
+
+func TestRenderGhostAppScripts(t *testing.T) {
+	cases := []struct {
+		Input          ghost.App
+		ExpectedOutput ghost.App
+		Valid          bool
+	}{
+		{
+			ghost.App{
+				Name:                 "wordpress",
+				Env:                  "prod",
+				EnvironmentVariables: &[]ghost.EnvironmentVariable{{Key: "PORT", Value: "80"}},
+				Modules: &[]ghost.Module{
+					{
+						Name:       "www",
+						Path:       "/var/www",
+						PreDeploy:  StrToB64("echo {{ .App.Name }}-{{ .App.Env }} {{ .Module.Path }}"),
+						PostDeploy: StrToB64(HashSum("salt", "echo {{ .App.Name }}")),
+					},
+				},
+				LifecycleHooks: &ghost.LifecycleHooks{PreBootstrap: StrToB64("echo {{ .Vars.PORT }}")},
+			},
+			ghost.App{
+				Name:                 "wordpress",
+				Env:                  "prod",
+				EnvironmentVariables: &[]ghost.EnvironmentVariable{{Key: "PORT", Value: "80"}},
+				Modules: &[]ghost.Module{
+					{
+						Name:       "www",
+						Path:       "/var/www",
+						PreDeploy:  StrToB64("echo wordpress-prod /var/www"),
+						PostDeploy: StrToB64(HashSum("salt", "echo {{ .App.Name }}")),
+					},
+				},
+				LifecycleHooks: &ghost.LifecycleHooks{PreBootstrap: StrToB64("echo 80")},
+			},
+			true,
+		},
+		{
+			ghost.App{
+				EnvironmentVariables: &[]ghost.EnvironmentVariable{},
+				Modules:              &[]ghost.Module{{Name: "www", PreDeploy: StrToB64("echo {{ .Vars.PORT }}")}},
+				LifecycleHooks:       &ghost.LifecycleHooks{},
+			},
+			ghost.App{},
+			false,
+		},
+		{
+			ghost.App{
+				EnvironmentVariables: &[]ghost.EnvironmentVariable{},
+				Modules:              &[]ghost.Module{},
+				LifecycleHooks:       &ghost.LifecycleHooks{PostBootstrap: StrToB64("echo {{ .App.Unknown }}")},
+			},
+			ghost.App{},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		err := renderGhostAppScripts(&tc.Input)
+		if tc.Valid != (err == nil) {
+			t.Fatalf("Unexpected output from renderGhostAppScripts: %v", err)
+		}
+		if tc.Valid && !reflect.DeepEqual(tc.Input, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from renderGhostAppScripts.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, tc.Input)
+		}
+	}
+}
+
+func TestFlattenGhostAppModulesTemplates(t *testing.T) {
+	app := ghost.App{
+		Name:    "wordpress",
+		Modules: &[]ghost.Module{{Name: "www", Path: "/var/www"}},
+	}
+	moduleList := []interface{}{
+		map[string]interface{}{
+			"name":        "www",
+			"pre_deploy":  "cd /var/www",
+			"post_deploy": "echo changed",
+		},
+	}
+	configured := []interface{}{
+		map[string]interface{}{
+			"name":        "www",
+			"pre_deploy":  "cd {{ .Module.Path }}",
+			"post_deploy": "echo {{ .App.Name }}",
+		},
+	}
+	expected := []interface{}{
+		map[string]interface{}{
+			"name":        "www",
+			"pre_deploy":  "cd {{ .Module.Path }}",
+			"post_deploy": "echo changed",
+		},
+	}
+
+	flattenGhostAppModulesTemplates(moduleList, configured, newGhostAppTemplateData(app, nil))
+	if !reflect.DeepEqual(moduleList, expected) {
+		t.Fatalf("Unexpected output from flattenGhostAppModulesTemplates.\nExpected: %#v\nGiven:    %#v",
+			expected, moduleList)
+	}
+}
+
+func TestSuppressDiffScriptFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "ghost_app_script")
+	if err != nil {
+		t.Fatalf("Unable to create script file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("echo {{ .App.Name }}")
+	file.Close()
+
+	module := map[string]interface{}{
+		"name":             "www",
+		"git_repo":         "https://github.com/test/test.git",
+		"path":             "/var/www",
+		"scope":            "code",
+		"order":            1,
+		"post_deploy_file": file.Name(),
+	}
+	key := fmt.Sprintf("keyed_modules.%d.post_deploy_file", hashGhostAppKeyedModule(module))
+
+	cases := []struct {
+		RenderTemplates bool
+		Old             string
+		Suppressed      bool
+	}{
+		{false, HashSum("salt", "echo {{ .App.Name }}"), true},
+		{false, HashSum("salt", "echo app_name"), false},
+		{true, HashSum("salt", "echo app_name"), true},
+		{true, HashSum("salt", "echo {{ .App.Name }}"), false},
+	}
+
+	for _, tc := range cases {
+		d := schema.TestResourceDataRaw(t, resourceGhostApp().Schema, map[string]interface{}{
+			"name":             "app_name",
+			"render_templates": tc.RenderTemplates,
+			"keyed_modules":    []interface{}{module},
+			"lifecycle_hooks":  []interface{}{map[string]interface{}{}},
+			"build_infos": []interface{}{
+				map[string]interface{}{"subnet_id": "subnet-1", "source_ami": "ami-1"},
+			},
+			"environment_infos": []interface{}{
+				map[string]interface{}{"instance_profile": "profile"},
+			},
+		})
+		d.Set("hash_salt", "salt")
+		suppressed := suppressDiffScriptFile()(key, tc.Old, file.Name(), d)
+		if suppressed != tc.Suppressed {
+			t.Fatalf("Unexpected output from suppressDiffScriptFile for %#v: %v", tc, suppressed)
+		}
+	}
+}
+
+func TestFlattenGhostAppMetadata(t *testing.T) {
+	created, updated, version := "Tue, 02 Oct 2018 10:00:00 GMT", "Wed, 03 Oct 2018 10:00:00 GMT", int64(3)
+	app := ghost.App{
+		EveItemMetadata: ghost.EveItemMetadata{
+			Created: &created,
+			Updated: &updated,
+			Version: &version,
+		},
+		User:           "ghost-admin",
+		Modules:        &[]ghost.Module{},
+		LifecycleHooks: &ghost.LifecycleHooks{},
+	}
+	app.Links = &struct {
+		Self ghost.Link `json:"self,omitempty"`
+	}{Self: ghost.Link{Href: "apps/5bb3"}}
+
+	d := resourceGhostApp().TestResourceData()
+	if err := flattenGhostApp(d, app, app); err != nil {
+		t.Fatalf("Unexpected error from flattenGhostApp: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"created_at":       created,
+		"updated_at":       updated,
+		"version":          3,
+		"last_modified_by": "ghost-admin",
+	}
+	for k, v := range expected {
+		if !reflect.DeepEqual(d.Get(k), v) {
+			t.Fatalf("Unexpected %s from flattenGhostApp.\nExpected: %#v\nGiven:    %#v", k, v, d.Get(k))
+		}
+	}
+
+	for _, endpoint := range []string{"https://ghost.domain.com", "https://ghost.domain.com/"} {
+		if url := ghostAppAPIURL(endpoint, app); url != "https://ghost.domain.com/apps/5bb3" {
+			t.Fatalf("Unexpected output from ghostAppAPIURL: %s", url)
+		}
+	}
+	if url := ghostAppAPIURL("https://ghost.domain.com", ghost.App{}); url != "" {
+		t.Fatalf("Unexpected output from ghostAppAPIURL: %s", url)
+	}
+}
+
+func TestFlattenGhostAppPendingChanges(t *testing.T) {
+	cases := []struct {
+		Input          *[]ghost.PendingChange
+		ExpectedOutput []interface{}
+	}{
+		{
+			&[]ghost.PendingChange{
+				{Field: "features", Updated: "2018-10-02 10:00:00", User: "ghost-admin"},
+			},
+			[]interface{}{
+				map[string]interface{}{
+					"field":   "features",
+					"updated": "2018-10-02 10:00:00",
+					"user":    "ghost-admin",
+				},
+			},
+		},
+		{
+			nil,
+			[]interface{}{},
+		},
+	}
+
+	for _, tc := range cases {
+		output := flattenGhostAppPendingChanges(tc.Input)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from flattener.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestValidateGhostAppPendingChanges(t *testing.T) {
+	cases := []struct {
+		Input         []interface{}
+		ExpectedError string
+	}{
+		{[]interface{}{}, ""},
+		{
+			[]interface{}{
+				map[string]interface{}{"field": "features", "updated": "2018-10-02 10:00:00", "user": "admin"},
+				map[string]interface{}{"field": "build_infos", "updated": "2018-10-03 10:00:00", "user": "admin"},
+			},
+			"app has pending changes, a buildimage or deployment is needed: " +
+				"features (updated 2018-10-02 10:00:00 by admin), build_infos (updated 2018-10-03 10:00:00 by admin)",
+		},
+	}
+
+	for _, tc := range cases {
+		errs := validateGhostAppPendingChanges(tc.Input)
+		if tc.ExpectedError == "" && len(errs) != 0 ||
+			tc.ExpectedError != "" && (len(errs) != 1 || errs[0].Error() != tc.ExpectedError) {
+			t.Fatalf("Unexpected output from validateGhostAppPendingChanges: %v", errs)
+		}
+	}
+}
+
+func TestFlattenGhostAppUndeployedModules(t *testing.T) {
+	initialized, notInitialized := true, false
+
+	cases := []struct {
+		Input          *[]ghost.Module
+		ExpectedOutput []interface{}
+	}{
+		{
+			&[]ghost.Module{
+				{Name: "deployed", Initialized: &initialized},
+				{Name: "new", Initialized: &notInitialized},
+				{Name: "unknown"},
+			},
+			[]interface{}{"new", "unknown"},
+		},
+		{
+			nil,
+			[]interface{}{},
+		},
+	}
+
+	for _, tc := range cases {
+		output := flattenGhostAppUndeployedModules(tc.Input)
+		if !reflect.DeepEqual(output, tc.ExpectedOutput) {
+			t.Fatalf("Unexpected output from flattener.\nExpected: %#v\nGiven:    %#v",
+				tc.ExpectedOutput, output)
+		}
+	}
+}
+
+func TestGhostAppAttributesFields(t *testing.T) {
+	resourceSchema := resourceGhostApp().Schema
+	for attribute, s := range resourceSchema {
+		if _, ok := ghostAppAttributesFields[attribute]; (s.Optional || s.Required) && !ok {
+			t.Fatalf("Attribute %s is not mapped to Ghost app fields", attribute)
+		}
+	}
+	for attribute := range ghostAppAttributesFields {
+		if _, ok := resourceSchema[attribute]; !ok {
+			t.Fatalf("Unknown attribute %s is mapped to Ghost app fields", attribute)
+		}
+	}
+
+	document := map[string]interface{}{}
+	data, _ := json.Marshal(ghost.App{})
+	json.Unmarshal(data, &document)
+	for attribute, fields := range ghostAppAttributesFields {
+		for _, field := range fields {
+			if _, ok := document[field]; !ok {
+				t.Fatalf("Attribute %s is mapped to unknown Ghost app field %s", attribute, field)
+			}
+		}
+	}
+}
+
+func TestGhostAppChangedFields(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceGhostApp().Schema, map[string]interface{}{
+		"name": "app_name",
+		"env":  "test",
+		"environment_variables_map": map[string]interface{}{
+			"myvar": "myvalue",
+		},
+		"sensitive_environment_variables": []interface{}{
+			map[string]interface{}{"key": "password", "value": "secret"},
+		},
+		"fail_on_pending_changes": true,
+	})
+
+	expected := []string{"env", "env_vars", "name"}
+	output := ghostAppChangedFields(d)
+	if !reflect.DeepEqual(output, expected) {
+		t.Fatalf("Unexpected output from ghostAppChangedFields.\nExpected: %#v\nGiven:    %#v",
+			expected, output)
+	}
+}
+
+func TestGhostAppPatch(t *testing.T) {
+	app := ghost.App{
+		Name:           "wordpress",
+		Env:            "prod",
+		SafeDeployment: &ghost.SafeDeployment{WaitBeforeDeploy: 10},
+		Modules:        &[]ghost.Module{{Name: "www", PreDeploy: StrToB64("echo")}},
+	}
+
+	output, err := ghostAppPatch(app, []string{"env", "safe-deployment"})
+	if err != nil {
+		t.Fatalf("Unexpected error from ghostAppPatch: %v", err)
+	}
+	data, _ := json.Marshal(output)
+	expected := `{"env":"prod","safe-deployment":{"wait_before_deploy":10,"wait_after_deploy":0,` +
+		`"load_balancer_type":"","app_tag_value":"","ha_backend":"","api_port":0}}`
+	if string(data) != expected {
+		t.Fatalf("Unexpected output from ghostAppPatch.\nExpected: %s\nGiven:    %s", expected, data)
+	}
+
+	if _, err := ghostAppPatch(app, []string{"unknown"}); err == nil {
+		t.Fatalf("Expected error from ghostAppPatch with unknown field")
+	}
+}
+
+func TestGhostAppChangedDocumentFields(t *testing.T) {
+	initialized := true
+	base := ghost.App{
+		Name:    "wordpress",
+		Modules: &[]ghost.Module{{Name: "www"}},
+	}
+	latest := ghost.App{
+		EveItemMetadata: ghost.EveItemMetadata{ID: "123"},
+		User:            "ghost-admin",
+		Name:            "wordpress",
+		Description:     "Updated in Ghost",
+		Modules:         &[]ghost.Module{{Name: "www", LastDeployment: "456", Initialized: &initialized}},
+	}
+
+	expected := []string{"description"}
+	output, err := ghostAppChangedDocumentFields(base, latest)
+	if err != nil {
+		t.Fatalf("Unexpected error from ghostAppChangedDocumentFields: %v", err)
+	}
+	if !reflect.DeepEqual(output, expected) {
+		t.Fatalf("Unexpected output from ghostAppChangedDocumentFields.\nExpected: %#v\nGiven:    %#v",
+			expected, output)
+	}
+	if (*latest.Modules)[0].LastDeployment != "456" {
+		t.Fatalf("ghostAppChangedDocumentFields should not modify the given apps")
+	}
+}
+
+func TestGhostAppConflictFreeEtag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := "latest"
+		app := ghost.App{
+			EveItemMetadata: ghost.EveItemMetadata{ID: "123", Etag: &etag},
+			Name:            "wordpress",
+			Description:     "Updated in Ghost",
+			Modules:         &[]ghost.Module{{Name: "www", LastDeployment: "456"}},
+		}
+		if r.URL.Query().Get("version") == "1" {
+			app.Description = ""
+			app.Modules = &[]ghost.Module{{Name: "www"}}
+		}
+		json.NewEncoder(w).Encode(app)
+	}))
+	defer server.Close()
+
+	client := &GhostClient{Endpoint: server.URL, Auth: BasicAuth{Username: "user", Password: "password"}}
+	d := resourceGhostApp().TestResourceData()
+	d.SetId("123")
+	d.Set("version", 1)
+
+	cases := []struct {
+		Fields []string
+		Valid  bool
+	}{
+		{[]string{"modules", "name"}, true},
+		{[]string{"description", "modules"}, false},
+		{nil, false},
+	}
+
+	for _, tc := range cases {
+		etag, err := ghostAppConflictFreeEtag(client, d, tc.Fields)
+		if tc.Valid != (err == nil) {
+			t.Fatalf("Unexpected output from ghostAppConflictFreeEtag for %#v: %v", tc.Fields, err)
+		}
+		if tc.Valid && etag != "latest" {
+			t.Fatalf("Unexpected etag from ghostAppConflictFreeEtag: %s", etag)
+		}
+	}
+}
+
+const (
+	testAlphaNum      = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	testLowerAlphaNum = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+func testRandomString(r *rand.Rand, charset string, min int, max int) string {
+	chars := []rune(charset)
+	s := make([]rune, min+r.Intn(max-min+1))
+	for i := range s {
+		s[i] = chars[r.Intn(len(chars))]
+	}
+	return string(s)
+}
+
+// Get a random text, such as a script, without interpolations
+func testRandomText(r *rand.Rand) string {
+	if r.Intn(3) == 0 {
+		return ""
+	}
+	return testRandomString(r, testAlphaNum+" \n\t#!/\"'{}[]<>&é€", 1, 100)
+}
+
+func testRandomChoice(r *rand.Rand, choices ...string) string {
+	return choices[r.Intn(len(choices))]
+}
+
+// Get a random Ghost app, valid for the schema. Attributes which Ghost may not
+// return are randomly nil.
+func testGhostAppRandom(r *rand.Rand) ghost.App {
+	etag, created, version := testRandomString(r, testLowerAlphaNum, 40, 40), "Tue, 02 Oct 2018 10:00:00 GMT", r.Int63n(10)+1
+	app := ghost.App{
+		EveItemMetadata: ghost.EveItemMetadata{
+			ID:      testRandomString(r, testLowerAlphaNum, 24, 24),
+			Etag:    &etag,
+			Created: &created,
+			Updated: &created,
+			Version: &version,
+		},
+		User: testRandomChoice(r, "", "ghost-admin"),
+
+		Name:               testRandomString(r, testAlphaNum+"_.+-", 1, 20),
+		Env:                testRandomString(r, testLowerAlphaNum+"-_", 1, 10),
+		Role:               testRandomString(r, testLowerAlphaNum+"-_", 1, 10),
+		Description:        testRandomText(r),
+		Region:             testRandomChoice(r, "", "eu-west-1", "us-east-1"),
+		InstanceType:       testRandomChoice(r, "", "t2.micro", "m5.large"),
+		InstanceMonitoring: r.Intn(2) == 0,
+		VpcID:              "vpc-" + testRandomString(r, testLowerAlphaNum, 1, 8),
+
+		BuildInfos: &ghost.BuildInfos{
+			SshUsername:    testRandomChoice(r, "admin", "ec2-user"),
+			SubnetID:       "subnet-" + testRandomString(r, testLowerAlphaNum, 1, 8),
+			AmiName:        testRandomChoice(r, "", "ami.built.by.ghost"),
+			ContainerImage: testRandomChoice(r, "", "built-by-ghost:latest"),
+		},
+		EnvironmentInfos: testGhostAppRandomEnvironmentInfos(r),
+	}
+	if r.Intn(2) == 0 {
+		app.BuildInfos.SourceAmi = "ami-" + testRandomString(r, testLowerAlphaNum, 1, 8)
+	} else {
+		app.BuildInfos.SourceContainerImage = "debian:" + testRandomString(r, testLowerAlphaNum, 1, 8)
+	}
+
+	// Apps have at least one module
+	modules := []ghost.Module{}
+	for i := r.Intn(4); i >= 0; i-- {
+		module := ghost.Module{
+			Name:    fmt.Sprintf("%s%d", testRandomString(r, testAlphaNum+".-_", 1, 10), i),
+			GitRepo: "https://github.com/test/" + testRandomString(r, testAlphaNum, 1, 10) + ".git",
+			Path:    "/var/" + testRandomString(r, testAlphaNum+".-_", 1, 10),
+			Scope:   testRandomChoice(r, "code", "system"),
+			UID:     r.Intn(1000),
+			GID:     r.Intn(1000),
+
+			LastDeployment: testRandomChoice(r, "", testRandomString(r, testLowerAlphaNum, 24, 24)),
+		}
+		if r.Intn(3) > 0 {
+			initialized := r.Intn(2) == 0
+			module.Initialized = &initialized
+		}
+		scripts := ghostAppModuleScripts(&module)
+		for _, name := range ghostAppModuleScriptNames {
+			*scripts[name] = StrToB64(testRandomText(r))
+		}
+		modules = append(modules, module)
+	}
+	app.Modules = &modules
+
+	if r.Intn(4) > 0 {
+		features := []ghost.Feature{}
+		for i := r.Intn(3); i >= 0; i-- {
+			feature := ghost.Feature{
+				Name:        testRandomString(r, testAlphaNum+".-_", 1, 10),
+				Version:     testRandomChoice(r, "", "1.0", "5.4"),
+				Provisioner: testRandomChoice(r, "ansible", "salt"),
+			}
+			if r.Intn(4) > 0 {
+				parameters := map[string]interface{}{}
+				for j := r.Intn(4); j > 0; j-- {
+					parameters[testRandomString(r, testAlphaNum+"_", 1, 10)] = testGhostAppRandomParameter(r, 2)
+				}
+				feature.Parameters = parameters
+			}
+			features = append(features, feature)
+		}
+		app.Features = &features
+	}
+
+	if r.Intn(2) == 0 {
+		app.Autoscale = &ghost.Autoscale{
+			Name:          testRandomChoice(r, "", testRandomString(r, testAlphaNum, 1, 10)),
+			EnableMetrics: r.Intn(2) == 0,
+			Min:           r.Intn(3),
+		}
+		app.Autoscale.Max = app.Autoscale.Min + r.Intn(3)
+	}
+
+	if r.Intn(2) == 0 {
+		app.LifecycleHooks = &ghost.LifecycleHooks{}
+		scripts := ghostAppLifecycleHooksScripts(app.LifecycleHooks)
+		for _, name := range ghostAppLifecycleHookNames {
+			*scripts[name] = StrToB64(testRandomText(r))
+		}
+	}
+
+	if r.Intn(4) > 0 {
+		notifications := []string{}
+		for i := r.Intn(3); i > 0; i-- {
+			notifications = append(notifications, testRandomString(r, testAlphaNum, 1, 10)+"@domain.com")
+		}
+		app.LogNotifications = notifications
+	}
+
+	if r.Intn(4) > 0 {
+		environmentVariables := []ghost.EnvironmentVariable{}
+		for i := r.Intn(5); i > 0; i-- {
+			environmentVariables = append(environmentVariables, ghost.EnvironmentVariable{
+				Key:   fmt.Sprintf("%s_%d", testRandomString(r, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ", 1, 10), i),
+				Value: testRandomString(r, testAlphaNum+" -_/:", 1, 20),
+			})
+		}
+		app.EnvironmentVariables = &environmentVariables
+	}
+
+	if r.Intn(2) == 0 {
+		app.SafeDeployment = &ghost.SafeDeployment{
+			WaitBeforeDeploy: r.Intn(20),
+			WaitAfterDeploy:  r.Intn(20),
+			LoadBalancerType: testRandomChoice(r, "elb", "alb", "haproxy"),
+		}
+		if app.SafeDeployment.LoadBalancerType == "haproxy" || r.Intn(2) == 0 {
+			app.SafeDeployment.HaBackend = testRandomString(r, testAlphaNum, 1, 10)
+			app.SafeDeployment.ApiPort = 1 + r.Intn(65535)
+			app.SafeDeployment.AppTagValue = testRandomString(r, testAlphaNum, 1, 10)
+		}
+	}
+
+	pendingChanges := []ghost.PendingChange{{Field: "modules", Updated: created, User: "ghost-admin"}}
+	app.PendingChanges = [](*[]ghost.PendingChange){nil, &pendingChanges}[r.Intn(2)]
+
+	return app
+}
+
+func testGhostAppRandomEnvironmentInfos(r *rand.Rand) *ghost.EnvironmentInfos {
+	environmentInfos := &ghost.EnvironmentInfos{
+		InstanceProfile: testRandomString(r, testAlphaNum+".-_", 1, 20),
+		KeyName:         testRandomString(r, testAlphaNum+".-_", 1, 20),
+		PublicIpAddress: r.Intn(2) == 0,
+	}
+
+	if r.Intn(4) > 0 {
+		environmentInfos.SecurityGroups = []string{}
+		for i := r.Intn(3); i > 0; i-- {
+			environmentInfos.SecurityGroups = append(environmentInfos.SecurityGroups,
+				"sg-"+testRandomString(r, testLowerAlphaNum, 1, 8))
+		}
+	}
+	if r.Intn(4) > 0 {
+		environmentInfos.SubnetIDs = []string{}
+		for i := r.Intn(3); i > 0; i-- {
+			environmentInfos.SubnetIDs = append(environmentInfos.SubnetIDs,
+				"subnet-"+testRandomString(r, testLowerAlphaNum, 1, 8))
+		}
+	}
+	if r.Intn(4) > 0 {
+		instanceTags := []ghost.InstanceTag{}
+		for i := r.Intn(3); i > 0; i-- {
+			instanceTags = append(instanceTags, ghost.InstanceTag{
+				TagName:  testRandomString(r, testAlphaNum, 1, 10),
+				TagValue: testRandomString(r, testAlphaNum+" ", 1, 10),
+			})
+		}
+		environmentInfos.InstanceTags = &instanceTags
+	}
+	if r.Intn(4) > 0 {
+		optionalVolumes := []ghost.OptionalVolume{}
+		for i, device := range r.Perm(r.Intn(4)) {
+			volume := ghost.OptionalVolume{
+				DeviceName:                fmt.Sprintf("/dev/xvd%c", 'b'+device),
+				VolumeType:                testRandomChoice(r, "gp2", "io1", "standard", "st1", "sc1"),
+				VolumeSize:                1 + r.Intn(100) + i,
+				LaunchBlockDeviceMappings: r.Intn(2) == 0,
+			}
+			if volume.VolumeType == "io1" {
+				volume.Iops = r.Intn(1000)
+			}
+			optionalVolumes = append(optionalVolumes, volume)
+		}
+		environmentInfos.OptionalVolumes = &optionalVolumes
+	}
+	if r.Intn(2) == 0 {
+		environmentInfos.RootBlockDevice = &ghost.RootBlockDevice{
+			Size: 20 + r.Intn(100),
+			Name: testRandomChoice(r, "", "/dev/xvda", "xvda"),
+		}
+	}
+
+	return environmentInfos
+}
+
+// Get a random feature parameter value, as decoded from JSON
+func testGhostAppRandomParameter(r *rand.Rand, depth int) interface{} {
+	switch r.Intn(6) {
+	case 0:
+		return float64(r.Intn(10000)) / 4
+	case 1:
+		return r.Intn(2) == 0
+	case 2:
+		if depth > 0 {
+			values := []interface{}{}
+			for i := r.Intn(3); i > 0; i-- {
+				values = append(values, testGhostAppRandomParameter(r, depth-1))
+			}
+			return values
+		}
+	case 3:
+		if depth > 0 {
+			values := map[string]interface{}{}
+			for i := r.Intn(3); i > 0; i-- {
+				values[testRandomString(r, testAlphaNum, 1, 5)] = testGhostAppRandomParameter(r, depth-1)
+			}
+			return values
+		}
+	}
+	return testRandomString(r, testAlphaNum+" -_/:<>&", 0, 20)
+}
+
+// Get the app expanded from a Ghost app once flattened. Attributes computed
+// by Ghost are not sent back, missing lists and blocks are sent empty, missing
+// feature parameters are sent as an empty object and a missing safe_deployment
+// is sent with its defaults.
+func testGhostAppNormalize(app ghost.App) ghost.App {
+	app.EveItemMetadata = ghost.EveItemMetadata{}
+	app.User = ""
+	app.PendingChanges = nil
+
+	modules := []ghost.Module{}
+	if app.Modules != nil {
+		for _, module := range *app.Modules {
+			module.Initialized = nil
+			module.LastDeployment = ""
+			modules = append(modules, module)
+		}
+	}
+	app.Modules = &modules
+
+	features := []ghost.Feature{}
+	if app.Features != nil {
+		for _, feature := range *app.Features {
+			if feature.Parameters == nil {
+				feature.Parameters = map[string]interface{}{}
+			}
+			features = append(features, feature)
+		}
+	}
+	app.Features = &features
+
+	buildInfos := *app.BuildInfos
+	buildInfos.AmiName = ""
+	buildInfos.ContainerImage = ""
+	app.BuildInfos = &buildInfos
+
+	environmentInfos := *app.EnvironmentInfos
+	if environmentInfos.SecurityGroups == nil {
+		environmentInfos.SecurityGroups = []string{}
+	}
+	if environmentInfos.SubnetIDs == nil {
+		environmentInfos.SubnetIDs = []string{}
+	}
+	if environmentInfos.InstanceTags == nil {
+		environmentInfos.InstanceTags = &[]ghost.InstanceTag{}
+	}
+	if environmentInfos.OptionalVolumes == nil {
+		environmentInfos.OptionalVolumes = &[]ghost.OptionalVolume{}
+	}
+	app.EnvironmentInfos = &environmentInfos
+
+	if app.Autoscale == nil {
+		app.Autoscale = &ghost.Autoscale{}
+	}
+	if app.LifecycleHooks == nil {
+		app.LifecycleHooks = &ghost.LifecycleHooks{}
+	}
+	if app.LogNotifications == nil {
+		app.LogNotifications = []string{}
+	}
+	if app.EnvironmentVariables == nil {
+		app.EnvironmentVariables = &[]ghost.EnvironmentVariable{}
+	}
+	if app.SafeDeployment == nil {
+		app.SafeDeployment = &ghost.SafeDeployment{WaitBeforeDeploy: 10, WaitAfterDeploy: 10, LoadBalancerType: "elb"}
+	}
+
+	return app
+}
+
+// Get the configuration of the attributes of a resource, leaving out computed
+// attributes and empty lists
+func testGhostAppConfigValues(s map[string]*schema.Schema, values map[string]interface{}) map[string]interface{} {
+	configValues := map[string]interface{}{}
+
+	for k, v := range values {
+		attribute, ok := s[k]
+		if !ok || !attribute.Optional && !attribute.Required {
+			continue
+		}
+
+		switch attribute.Type {
+		case schema.TypeList, schema.TypeSet:
+			if set, ok := v.(*schema.Set); ok {
+				v = set.List()
+			}
+			list := []interface{}{}
+			for _, item := range v.([]interface{}) {
+				if elem, ok := attribute.Elem.(*schema.Resource); ok {
+					item = testGhostAppConfigValues(elem.Schema, item.(map[string]interface{}))
+				}
+				list = append(list, item)
+			}
+			if len(list) == 0 {
+				continue
+			}
+			v = list
+		case schema.TypeMap:
+			if len(v.(map[string]interface{})) == 0 {
+				continue
+			}
+		}
+
+		configValues[k] = v
+	}
+
+	return configValues
+}
+
+// Randomly move values of a configuration to the alternative attributes
+// giving the same app: sensitive environment variables, environment variables
+// map, keyed modules, script files and feature parameter blocks
+func testGhostAppRandomConfig(r *rand.Rand, values map[string]interface{}, dir string) {
+	if environmentVariables, ok := values["environment_variables"].([]interface{}); ok {
+		regular, sensitive := []interface{}{}, []interface{}{}
+		for _, environmentVariable := range environmentVariables {
+			if r.Intn(3) == 0 {
+				sensitive = append(sensitive, environmentVariable)
+			} else {
+				regular = append(regular, environmentVariable)
+			}
+		}
+		delete(values, "environment_variables")
+		if len(sensitive) > 0 {
+			values["sensitive_environment_variables"] = sensitive
+		}
+		if len(regular) > 0 && r.Intn(2) == 0 {
+			environmentVariablesMap := map[string]interface{}{}
+			for _, environmentVariable := range regular {
+				data := environmentVariable.(map[string]interface{})
+				environmentVariablesMap[data["key"].(string)] = data["value"]
+			}
+			values["environment_variables_map"] = environmentVariablesMap
+		} else if len(regular) > 0 {
+			values["environment_variables"] = regular
+		}
+	}
+
+	scriptFiles := func(data map[string]interface{}, names []string) {
+		for _, name := range names {
+			if script := data[name].(string); script != "" && r.Intn(3) == 0 {
+				file := filepath.Join(dir, fmt.Sprintf("%d.sh", r.Int63()))
+				ioutil.WriteFile(file, []byte(script), 0644)
+				data[name] = ""
+				data[name+"_file"] = file
+			}
+		}
+	}
+	if modules, ok := values["modules"].([]interface{}); ok {
+		for _, module := range modules {
+			scriptFiles(module.(map[string]interface{}), ghostAppModuleScriptNames)
+		}
+		if r.Intn(2) == 0 {
+			order := r.Intn(3)
+			for _, module := range modules {
+				module.(map[string]interface{})["order"] = order
+				order += 1 + r.Intn(3)
+			}
+			delete(values, "modules")
+			values["keyed_modules"] = modules
+		}
+	}
+	if lifecycleHooks, ok := values["lifecycle_hooks"].([]interface{}); ok {
+		scriptFiles(lifecycleHooks[0].(map[string]interface{}), ghostAppLifecycleHookNames)
+	}
+
+	// Parameters are also formatted differently from Ghost
+	features, _ := values["features"].([]interface{})
+	for _, feature := range features {
+		data := feature.(map[string]interface{})
+		var parameters map[string]interface{}
+		if json.Unmarshal([]byte(data["parameters"].(string)), &parameters) != nil || len(parameters) == 0 {
+			continue
+		}
+		if r.Intn(2) == 0 {
+			parametersJSON, _ := json.MarshalIndent(parameters, "", "  ")
+			data["parameters"] = string(parametersJSON)
+			continue
+		}
+
+		names := []string{}
+		for name := range parameters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		parameterBlocks := []interface{}{}
+		for _, i := range r.Perm(len(names)) {
+			parameter := map[string]interface{}{"name": names[i]}
+			switch value := parameters[names[i]].(type) {
+			case string:
+				parameter["value"] = value
+			case float64:
+				parameter["value"] = strconv.FormatFloat(value, 'f', r.Intn(3)+2, 64)
+				parameter["type"] = "number"
+			case bool:
+				parameter["value"] = strconv.FormatBool(value)
+				parameter["type"] = "bool"
+			default:
+				valueJSON, _ := json.MarshalIndent(value, "", " ")
+				parameter["value"] = string(valueJSON)
+				parameter["type"] = "json"
+			}
+			parameterBlocks = append(parameterBlocks, parameter)
+		}
+		data["parameters"] = ""
+		data["parameter"] = parameterBlocks
+	}
+}
+
+// Get random provider default instance tags, some of them being set by the app
+// with the same value or another one
+func testGhostAppRandomDefaultInstanceTags(r *rand.Rand, app ghost.App) map[string]string {
+	defaults := map[string]string{}
+	for i := r.Intn(4); i > 0; i-- {
+		defaults[testRandomString(r, testAlphaNum, 1, 10)] = testRandomString(r, testAlphaNum+" ", 1, 10)
+	}
+	if app.EnvironmentInfos == nil || app.EnvironmentInfos.InstanceTags == nil {
+		return defaults
+	}
+	for _, instanceTag := range *app.EnvironmentInfos.InstanceTags {
+		switch r.Intn(4) {
+		case 0:
+			defaults[instanceTag.TagName] = instanceTag.TagValue
+		case 1:
+			defaults[instanceTag.TagName] = testRandomString(r, testAlphaNum, 1, 10)
+		}
+	}
+	return defaults
+}
+
+// Get random provider defaults, either unset, equal to the app values or not
+func testGhostAppRandomDefaults(r *rand.Rand, app ghost.App) GhostAppDefaults {
+	defaults := GhostAppDefaults{
+		Region: testRandomChoice(r, "", app.Region, "ap-south-1"),
+		VpcID:  testRandomChoice(r, "", app.VpcID, "vpc-"+testRandomString(r, testLowerAlphaNum, 1, 8)),
+	}
+
+	switch r.Intn(3) {
+	case 0:
+		defaults.LogNotifications = []string{testRandomString(r, testAlphaNum, 1, 10) + "@domain.com"}
+	case 1:
+		if len(app.LogNotifications) > 0 {
+			defaults.LogNotifications = append([]string{}, app.LogNotifications...)
+		}
+	}
+
+	switch r.Intn(3) {
+	case 0:
+		defaults.SafeDeployment = &ghost.SafeDeployment{
+			WaitBeforeDeploy: r.Intn(20),
+			WaitAfterDeploy:  r.Intn(20),
+			LoadBalancerType: testRandomChoice(r, "elb", "alb"),
+		}
+	case 1:
+		if app.SafeDeployment != nil {
+			safeDeployment := *app.SafeDeployment
+			defaults.SafeDeployment = &safeDeployment
+		}
+	}
+
+	return defaults
+}
+
+// Check that flattening any Ghost app then expanding it gives the same app,
+// apart from the documented differences
+func TestGhostAppRoundTrip(t *testing.T) {
+	property := func(seed int64) bool {
+		app := testGhostAppRandom(rand.New(rand.NewSource(seed)))
+
+		d := resourceGhostApp().TestResourceData()
+		if err := flattenGhostApp(d, app, app); err != nil {
+			t.Errorf("Unexpected error from flattenGhostApp with seed %d: %v", seed, err)
+			return false
+		}
+		expanded, err := expandGhostApp(d, nil)
+		if err != nil {
+			t.Errorf("Unexpected error from expandGhostApp with seed %d: %v", seed, err)
+			return false
+		}
+
+		if expected := testGhostAppNormalize(app); !reflect.DeepEqual(expanded, expected) {
+			t.Errorf("Unexpected round trip output with seed %d.\nExpected: %#v\nGiven:    %#v", seed, expected, expanded)
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Check that once an app is created from a configuration, reading it back
+// from Ghost gives no plan diff, whatever the attributes used to configure it
+func TestGhostAppRoundTripPlan(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ghost_app")
+	defer os.RemoveAll(dir)
+
+	resourceSchema := resourceGhostApp().Schema
+	server := ghosttest.NewServer()
+	defer server.Close()
+
+	property := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		app := testGhostAppRandom(r)
+
+		// Get a configuration giving the app
+		d := resourceGhostApp().TestResourceData()
+		if err := flattenGhostApp(d, app, app); err != nil {
+			t.Errorf("Unexpected error from flattenGhostApp with seed %d: %v", seed, err)
+			return false
+		}
+		values := map[string]interface{}{}
+		for k := range resourceSchema {
+			values[k] = d.Get(k)
+		}
+		values = testGhostAppConfigValues(resourceSchema, values)
+		testGhostAppRandomConfig(r, values, dir)
+		client := &GhostClient{
+			Endpoint:            server.URL,
+			Auth:                BasicAuth{Username: ghosttest.Username, Password: ghosttest.Password},
+			DefaultInstanceTags: testGhostAppRandomDefaultInstanceTags(r, app),
+			Defaults:            testGhostAppRandomDefaults(r, app),
+		}
+
+		// Ghost stores the app sent on creation along with its computed attributes
+		d = schema.TestResourceDataRaw(t, resourceSchema, values)
+		stored, err := expandGhostApp(d, client)
+		if err != nil {
+			t.Errorf("Unexpected error from expandGhostApp with seed %d: %v", seed, err)
+			return false
+		}
+		stored.EveItemMetadata, stored.User, stored.PendingChanges = app.EveItemMetadata, app.User, app.PendingChanges
+		stored.BuildInfos.AmiName, stored.BuildInfos.ContainerImage = app.BuildInfos.AmiName, app.BuildInfos.ContainerImage
+		for i := range *stored.Modules {
+			(*stored.Modules)[i].Initialized = (*app.Modules)[i].Initialized
+			(*stored.Modules)[i].LastDeployment = (*app.Modules)[i].LastDeployment
+		}
+
+		document := map[string]interface{}{}
+		data, _ := json.Marshal(stored)
+		json.Unmarshal(data, &document)
+		if _, err := server.Insert("apps", document); err != nil {
+			t.Errorf("Unexpected error storing the app with seed %d: %v", seed, err)
+			return false
+		}
+
+		d.SetId(app.ID)
+		effective := stored
+		flattenGhostAppProviderDefaults(d, &stored, client)
+		if err := flattenGhostApp(d, stored, effective); err != nil {
+			t.Errorf("Unexpected error from flattenGhostApp with seed %d: %v", seed, err)
+			return false
+		}
+
+		raw, err := config.NewRawConfig(values)
+		if err != nil {
+			t.Errorf("Unexpected error building configuration with seed %d: %v", seed, err)
+			return false
+		}
+		diff, err := resourceGhostApp().Diff(d.State(), terraform.NewResourceConfig(raw), client)
+		if err != nil {
+			t.Errorf("Unexpected error from Diff with seed %d: %v", seed, err)
+			return false
+		}
+		if !diff.Empty() {
+			changes := []string{}
+			for k, attribute := range diff.Attributes {
+				changes = append(changes, fmt.Sprintf("%s: %q => %q", k, attribute.Old, attribute.New))
+			}
+			sort.Strings(changes)
+			t.Errorf("Unexpected plan with seed %d:\n%s\nConfiguration: %#v", seed, strings.Join(changes, "\n"), values)
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Fatal(err)
+	}
+}